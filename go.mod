@@ -4,10 +4,12 @@ go 1.26.3
 
 require (
 	github.com/PuerkitoBio/goquery v1.9.1
+	github.com/klauspost/compress v1.18.0
 	github.com/tanaikech/go-getfilelist v2.0.0+incompatible
 	github.com/urfave/cli/v2 v2.27.1
 	github.com/vbauerster/mpb/v8 v8.7.2
 	golang.org/x/sync v0.20.0
+	golang.org/x/sys v0.45.0
 	golang.org/x/term v0.43.0
 	google.golang.org/api v0.169.0
 )
@@ -41,7 +43,6 @@ require (
 	golang.org/x/crypto v0.52.0 // indirect
 	golang.org/x/net v0.55.0 // indirect
 	golang.org/x/oauth2 v0.34.0 // indirect
-	golang.org/x/sys v0.45.0 // indirect
 	golang.org/x/text v0.37.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
 	google.golang.org/grpc v1.79.3 // indirect
@@ -3,25 +3,23 @@ package goodls
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"mime"
-	"net/http"
-	"net/http/cookiejar"
-	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
+	"goodls/pkg/goodls"
+
 	cli "github.com/urfave/cli/v2"
-	"github.com/vbauerster/mpb/v8"
-	"github.com/vbauerster/mpb/v8/decor"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/term"
 )
@@ -29,725 +27,154 @@ import (
 const (
 	appname = "goodls"
 	envval  = "GOODLS_APIKEY"
-	anyurl  = "https://drive.google.com/uc?export=download"
-	docutl  = "https://docs.google.com/"
-)
-
-// Para : Structure for each parameter
-type Para struct {
-	APIKey                string
-	Client                *http.Client
-	ContentType           string
-	Disp                  bool
-	DlFolder              bool
-	DownloadBytes         int64
-	Ext                   string
-	Filename              string
-	ID                    string
-	InputtedMimeType      []string
-	Kind                  string
-	Notcreatetopdirectory bool
-	OverWrite             bool
-	Resumabledownload     string
-	SearchID              string
-	ShowFileInf           bool
-	Size                  int64
-	Skip                  bool
-	SkipError             bool
-	URL                   string
-	WorkDir               string
-	URLForLargeFile       string
-	Concurrency           int
-
-	ConflictStrategy string
-	ConflictResolved bool
-	MCPMode          bool // True when operating inside an MCP server
-
-	Proxy      string
-	Verbose    bool
-	Retry      int
-	RetryDelay int
-	JSONOutput bool
-
-	Progress    *mpb.Progress
-	ResultJSONs *[]string
-	mu          *sync.Mutex
-}
-
-// Clone : Deep copy necessary fields to prevent race conditions during concurrent execution.
-func (p *Para) Clone() *Para {
-	newP := *p
-	return &newP
-}
-
-// getHTTPClient : Returns a new HTTP client configured with proxy settings and cookie jar.
-func (p *Para) getHTTPClient() *http.Client {
-	jar, _ := cookiejar.New(nil)
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-	}
-	if p.Proxy != "" {
-		if proxyURL, err := url.Parse(p.Proxy); err == nil {
-			transport.Proxy = http.ProxyURL(proxyURL)
-		} else {
-			if p.Verbose {
-				p.mu.Lock()
-				fmt.Fprintf(os.Stderr, "[Verbose] Invalid proxy URL %s: %v\n", p.Proxy, err)
-				p.mu.Unlock()
-			}
-		}
-	}
-	return &http.Client{
-		Jar:       jar,
-		Transport: transport,
-	}
-}
-
-// resolveConflict handles file existing conflicts
-func (p *Para) resolveConflict(targetPath string, remoteTime time.Time) (string, string, error) {
-	if !chkFile(targetPath) {
-		return targetPath, "overwrite", nil
-	}
-
-	strategy := p.ConflictStrategy
-
-	if strategy == "prompt" && p.MCPMode {
-		return "", "", fmt.Errorf("File '%s' already exists. Ask the user for the preferred conflict resolution strategy (skip, overwrite, newer, rename) and call this tool again with the explicit 'conflict' parameter.", filepath.Base(targetPath))
-	}
-
-	// Graceful fallback for non-interactive environments outside MCP
-	if strategy == "prompt" && !term.IsTerminal(int(syscall.Stdin)) {
-		strategy = "rename"
-	}
 
-prompt_loop:
-	for {
-		switch strategy {
-		case "skip":
-			return targetPath, "skip", nil
-		case "overwrite":
-			return targetPath, "overwrite", nil
-		case "newer":
-			localInfo, err := os.Stat(targetPath)
-			if err != nil {
-				return targetPath, "overwrite", nil
-			}
-			if remoteTime.IsZero() {
-				if !p.Disp {
-					p.mu.Lock()
-					fmt.Fprintf(os.Stderr, "[*] Warning: Cannot determine remote time for '%s'. Falling back to 'rename'.\n", filepath.Base(targetPath))
-					p.mu.Unlock()
-				}
-				strategy = "rename"
-				continue prompt_loop
-			}
-			if remoteTime.After(localInfo.ModTime()) {
-				return targetPath, "overwrite", nil
-			}
-			return targetPath, "skip", nil
-		case "rename":
-			ext := filepath.Ext(targetPath)
-			base := targetPath[:len(targetPath)-len(ext)]
-
-			timestamp := time.Now().Format("20060102_150405")
-			newPath := fmt.Sprintf("%s_%s%s", base, timestamp, ext)
-			if !chkFile(newPath) {
-				return newPath, "overwrite", nil
-			}
+	envDriveEndpoint = "GOODLS_DRIVE_ENDPOINT"
+	envDocsEndpoint  = "GOODLS_DOCS_ENDPOINT"
+	envAPIEndpoint   = "GOODLS_API_ENDPOINT"
+)
 
-			for i := 1; ; i++ {
-				newPath = fmt.Sprintf("%s_%s_%d%s", base, timestamp, i, ext)
-				if !chkFile(newPath) {
-					return newPath, "overwrite", nil
-				}
-			}
-		case "prompt":
-			p.mu.Lock()
-			fmt.Fprintf(os.Stderr, "\r\033[K[Conflict] File '%s' already exists.\n", filepath.Base(targetPath))
-			if p.DlFolder {
-				fmt.Fprintf(os.Stderr, "Hint: You are downloading a folder. Use '--conflict [skip|overwrite|newer|rename]' to avoid repeated prompts.\n")
-			}
-			fmt.Fprintf(os.Stderr, "Choose action - [s]kip, [o]verwrite, [n]ewer, [r]ename, [a]bort: ")
-
-			var input string
-			var b [1]byte
-			// Raw read to explicitly prevent bufio from consuming the pipe stream ahead of time
-			for {
-				n, err := os.Stdin.Read(b[:])
-				if err != nil || n == 0 {
-					break
-				}
-				if b[0] == '\n' {
-					break
-				}
-				if b[0] != '\r' {
-					input += string(b[0])
-				}
-			}
-			p.mu.Unlock()
-
-			input = strings.TrimSpace(strings.ToLower(input))
-			switch input {
-			case "s", "skip":
-				return targetPath, "skip", nil
-			case "o", "overwrite":
-				return targetPath, "overwrite", nil
-			case "n", "newer":
-				strategy = "newer"
-			case "r", "rename":
-				strategy = "rename"
-			case "a", "abort":
-				return targetPath, "abort", fmt.Errorf("download aborted by user for %s", targetPath)
-			default:
-				p.mu.Lock()
-				fmt.Fprintf(os.Stderr, "Invalid input. Please try again.\n")
-				p.mu.Unlock()
-			}
-		default:
-			return targetPath, "skip", fmt.Errorf("unknown conflict strategy: %s", strategy)
-		}
-	}
+// handler : Build a Downloader from the flags and run it.
+func handler(c *cli.Context) error {
+	return run(c, c.String("url"), c.String("output"))
 }
 
-// getURLFromHTML : Get the download URL from HTML robustly.
-func (p *Para) getURLFromHTML(html *http.Response) error {
-	br := html.Body
-	doc, err := goquery.NewDocumentFromReader(br)
-	if err != nil {
-		return err
-	}
-
-	var urlStr string
-	var b bool
-	var form *goquery.Selection
-
-	// Strategy 1: Conventional id="download-form"
-	form = doc.Find("form[id='download-form']")
-	if form.Length() > 0 {
-		urlStr, b = form.Attr("action")
-	}
-
-	// Strategy 2: Any <form> tag with action containing "confirm="
-	if !b {
-		doc.Find("form").Each(func(i int, s *goquery.Selection) {
-			if act, exists := s.Attr("action"); exists && strings.Contains(act, "confirm=") {
-				urlStr = act
-				b = true
-				form = s
-			}
-		})
-	}
-
-	// Strategy 3: Specific <a> tag link
-	if !b {
-		link := doc.Find("a[id='uc-download-link']")
-		if link.Length() > 0 {
-			if href, exists := link.Attr("href"); exists {
-				urlStr = href
-				b = true
-			}
-		}
-	}
-
-	// Strategy 4: Raw HTML regex fallback
-	if !b {
-		rawHTML, _ := doc.Html()
-		re := regexp.MustCompile(`/uc\?export=download(?:&amp;|&)confirm=[A-Za-z0-9_]+`)
-		match := re.FindString(rawHTML)
-		if match != "" {
-			urlStr = strings.ReplaceAll(match, "&amp;", "&")
-			b = true
-			if !strings.HasPrefix(urlStr, "http") {
-				urlStr = "https://drive.google.com" + urlStr
-			}
-		}
-	}
-
-	if !b {
-		if p.Verbose {
-			p.mu.Lock()
-			rawHTML, _ := doc.Html()
-			fmt.Fprintf(os.Stderr, "[Verbose] Failed to parse HTML. Raw HTML snippet length: %d\n", len(rawHTML))
-			p.mu.Unlock()
-		}
-		return fmt.Errorf("failed to extract Google Drive large-file warning download URL (specification of the endpoint might have been changed)")
-	}
-
-	if p.Verbose {
-		p.mu.Lock()
-		fmt.Fprintf(os.Stderr, "[Verbose] Extracted confirmation URL: %s\n", urlStr)
-		p.mu.Unlock()
-	}
-
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return err
+// catHandler : 'goodls cat URL' writes the file of URL to stdout.
+func catHandler(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("one URL is required\n\n $ %s cat URL", appname)
 	}
-	q := req.URL.Query()
-	if form != nil && form.Length() > 0 {
-		form.Find("input").Each(func(i int, s *goquery.Selection) {
-			t, bAttr := s.Attr("type")
-			if t == "hidden" && bAttr {
-				name, _ := s.Attr("name")
-				value, _ := s.Attr("value")
-				q.Add(name, value)
-			}
-		})
-	}
-	req.URL.RawQuery = q.Encode()
-	p.URLForLargeFile = req.URL.String()
-	return nil
+	return run(c, c.Args().First(), "-")
 }
 
-// saveFile : Save retrieved data as a file with progress bar integration.
-func (p *Para) saveFile(res *http.Response) error {
-	defer res.Body.Close()
-
+// run : Download urlFlag, or the URLs from stdin when it is empty. An output of "-" writes the file to stdout,
+// and then the results are printed to stderr.
+func run(c *cli.Context, urlFlag, output string) error {
 	var err error
-	if len(res.Header["Content-Type"]) > 0 {
-		p.ContentType = res.Header["Content-Type"][0]
-	}
-	if err = p.getFilename(res); err != nil {
-		return err
-	}
-
-	targetPath := filepath.Join(p.WorkDir, p.Filename)
-
-	if p.DownloadBytes == -1 && !p.ConflictResolved {
-		var remoteTime time.Time
-		if lastModified := res.Header.Get("Last-Modified"); lastModified != "" {
-			if t, err := http.ParseTime(lastModified); err == nil {
-				remoteTime = t
-			}
-		}
-
-		resolvedPath, action, err := p.resolveConflict(targetPath, remoteTime)
-		if err != nil {
-			return err
-		}
-		if action == "skip" {
-			p.Filename = filepath.Base(targetPath)
-			if !p.Disp {
-				p.mu.Lock()
-				fmt.Fprintf(os.Stderr, "[*] Skipped: '%s' already exists.\n", p.Filename)
-				p.mu.Unlock()
-			}
-			return nil
-		}
-
-		p.Filename = filepath.Base(resolvedPath)
-		targetPath = resolvedPath
-		p.ConflictResolved = true
-	}
-
-	var file *os.File
-	if p.DownloadBytes == -1 {
-		file, err = os.Create(targetPath)
-	} else {
-		file, err = os.OpenFile(targetPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	}
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	var reader io.Reader = res.Body
-
-	if p.Size <= 0 {
-		p.Size = res.ContentLength
+	toStdout := output == "-"
+	if toStdout && urlFlag == "" {
+		return fmt.Errorf("only one file given with '-u' can be written to stdout")
 	}
-
-	var bar *mpb.Bar
-	if !p.Disp && p.Progress != nil && !p.MCPMode {
-		nameDecor := decor.Name(p.Filename, decor.WCSyncSpaceR)
-		if p.Size > 0 {
-			bar = p.Progress.AddBar(p.Size,
-				mpb.PrependDecorators(
-					nameDecor,
-					decor.CountersKibiByte("% .2f / % .2f", decor.WCSyncSpaceR),
-				),
-				mpb.AppendDecorators(
-					decor.EwmaETA(decor.ET_STYLE_GO, 90),
-					decor.Name(" ] "),
-					decor.Percentage(),
-				),
-			)
-		} else {
-			bar = p.Progress.AddBar(0,
-				mpb.PrependDecorators(
-					nameDecor,
-					decor.CurrentKibiByte("% .2f", decor.WCSyncSpaceR),
-				),
-				mpb.AppendDecorators(
-					decor.OnComplete(decor.Spinner(nil), "Done"),
-				),
-			)
-		}
-		proxy := bar.ProxyReader(res.Body)
-		reader = proxy
-	}
-
-	_, err = io.Copy(file, reader)
-
-	if bar != nil {
-		if err != nil {
-			bar.Abort(false)
-		} else {
-			bar.SetTotal(-1, true)
-		}
+	resultOut := io.Writer(os.Stdout)
+	if toStdout {
+		resultOut = os.Stderr
 	}
 
-	if err != nil {
-		return err
-	}
-
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return err
-	}
-
-	resJSON := fmt.Sprintf("{\"Filename\": \"%s\", \"Type\": \"%s\", \"MimeType\": \"%s\", \"FileSize\": %d}", p.Filename, p.Kind, p.ContentType, fileInfo.Size())
-	p.mu.Lock()
-	*p.ResultJSONs = append(*p.ResultJSONs, resJSON)
-	if p.Disp && !p.MCPMode && !p.JSONOutput {
-		fmt.Println(resJSON)
+	workdir := c.String("directory")
+	filename := c.String("filename")
+	if output != "" && !toStdout {
+		workdir, filename = filepath.Dir(output), filepath.Base(output)
 	}
-	p.mu.Unlock()
-
-	return nil
-}
-
-// getFilename : Retrieve filename from header.
-func (p *Para) getFilename(s *http.Response) error {
-	if len(s.Header["Content-Disposition"]) > 0 {
-		_, paraMap, err := mime.ParseMediaType(s.Header["Content-Disposition"][0])
+	if workdir == "" {
+		workdir, err = filepath.Abs(".")
 		if err != nil {
 			return err
 		}
-		if p.Filename == "" {
-			p.Filename = paraMap["filename"]
-		}
-	} else {
-		body, _ := io.ReadAll(s.Body)
-		rFilename := regexp.MustCompile(`<span class="uc-name-size"><a[\w\s\S]+?>([\w\s\S]+?)<\/a>`)
-		matches := rFilename.FindAllStringSubmatch(string(body), -1)
-		if len(matches) == 0 {
-			return fmt.Errorf("file ID [ %s ] cannot be downloaded", p.ID)
-		}
-		p.Filename = matches[0][1]
 	}
-	return nil
-}
 
-// downloadLargeFile : When a large size of file is downloaded, this method is used.
-func (p *Para) downloadLargeFile() error {
-	if p.APIKey != "" {
-		dlfile, err := p.getFileInfFromP()
-		if err != nil {
-			return err
-		}
-		p.Size = dlfile.Size
+	conflictFlag := c.String("conflict")
+	if c.Bool("overwrite") {
+		conflictFlag = "overwrite"
+	} else if c.Bool("skip") {
+		conflictFlag = "skip"
 	}
-	res, err := p.fetch(p.URLForLargeFile)
+	conflict, err := goodls.ParseConflictStrategy(conflictFlag)
 	if err != nil {
 		return err
 	}
-	if res.StatusCode != 200 && p.Kind != "file" {
-		return fmt.Errorf("error: This error occurs when it downloads a large file of Google Docs.\nMessage: %+v", res)
-	}
-	return p.saveFile(res)
-}
-
-// fetch : Fetch data from Google Drive with automatic exponential backoff retry support.
-func (p *Para) fetch(url string) (*http.Response, error) {
-	var res *http.Response
-	var err error
-
-	maxRetries := p.Retry
-	if maxRetries < 0 {
-		maxRetries = 0
-	}
-
-	for i := 0; i <= maxRetries; i++ {
-		req, reqErr := http.NewRequest("GET", url, nil)
-		if reqErr != nil {
-			return nil, reqErr
-		}
-
-		if p.Verbose {
-			p.mu.Lock()
-			fmt.Fprintf(os.Stderr, "[Verbose] Fetching URL: %s (Attempt %d/%d)\n", url, i+1, maxRetries+1)
-			p.mu.Unlock()
-		}
-
-		res, err = p.Client.Do(req)
-
-		if err == nil {
-			if res.StatusCode == 429 || res.StatusCode >= 500 {
-				if p.Verbose {
-					p.mu.Lock()
-					fmt.Fprintf(os.Stderr, "[Verbose] HTTP %d received for %s\n", res.StatusCode, url)
-					p.mu.Unlock()
-				}
-				res.Body.Close()
-				err = fmt.Errorf("HTTP %d", res.StatusCode)
-			} else {
-				if p.Verbose {
-					p.mu.Lock()
-					fmt.Fprintf(os.Stderr, "[Verbose] Success HTTP %d for %s\n", res.StatusCode, url)
-					p.mu.Unlock()
-				}
-				return res, nil
-			}
-		} else {
-			if p.Verbose {
-				p.mu.Lock()
-				fmt.Fprintf(os.Stderr, "[Verbose] Error fetching %s: %v\n", url, err)
-				p.mu.Unlock()
-			}
-		}
-
-		if i < maxRetries {
-			delay := time.Duration(p.RetryDelay) * time.Second * time.Duration(1<<i)
-			if p.Verbose {
-				p.mu.Lock()
-				fmt.Fprintf(os.Stderr, "[Verbose] Waiting %v before retry...\n", delay)
-				p.mu.Unlock()
-			}
-			time.Sleep(delay)
-		}
-	}
-	return nil, err
-}
-
-// checkURL : Parse inputted URL.
-func (p *Para) checkURL(s string) error {
-	var err error
-	r := regexp.MustCompile(`google\.com\/(\w.+)\/d\/(\w.+)\/`)
-	r2 := regexp.MustCompile(`drive.google.com\/uc\?(export\=\w+|id\=([\w\S]+))&(export\=\w+|id\=([\w\S]+))`)
-	colabRegex := regexp.MustCompile(`colab\.research\.google\.com\/drive\/([a-zA-Z0-9-_]+)`)
-
-	if colabRegex.MatchString(s) {
-		res := colabRegex.FindStringSubmatch(s)
-		p.Kind = "file"
-		p.ID = res[1]
-		p.URL = anyurl + "&id=" + p.ID
-
-		if p.APIKey != "" && p.ShowFileInf {
-			if err := p.showFileInf(); err != nil {
-				return err
-			}
-			return nil
-		}
-		return nil
-	} else if r.MatchString(s) {
-		res := r.FindAllStringSubmatch(s, -1)
-		p.Kind = res[0][1]
-		p.ID = res[0][2]
-		if p.Kind == "file" {
-			p.URL = anyurl + "&id=" + p.ID
-		} else {
-			if p.Ext == "" {
-				p.Ext = "pdf"
-			} else if p.Ext == "ms" {
-				switch p.Kind {
-				case "spreadsheets":
-					p.Ext = "xlsx"
-				case "document":
-					p.Ext = "docx"
-				case "presentation":
-					p.Ext = "pptx"
-				}
-			}
-			if p.Kind == "presentation" {
-				p.URL = docutl + p.Kind + "/d/" + p.ID + "/export/" + p.Ext
-			} else {
-				p.URL = docutl + p.Kind + "/d/" + p.ID + "/export?format=" + p.Ext
-			}
-		}
-
-		if p.APIKey != "" && p.Kind == "file" {
-			p.URL = "https://www.googleapis.com/drive/v3/files/" + p.ID + "?alt=media&supportsAllDrives=true&key=" + p.APIKey
-			dlfile, err := p.getFileInfFromP()
-			if err != nil {
-				return err
-			}
-			p.Filename = dlfile.Name
-			p.Size = dlfile.Size
-		}
 
-		if p.APIKey != "" && p.ShowFileInf {
-			if err := p.showFileInf(); err != nil {
-				return err
-			}
-			return nil
-		}
-	} else if r2.MatchString(s) {
-		u, err := url.Parse(s)
-		if err != nil {
-			return err
-		}
-		q := u.Query()
-		p.Kind = "file"
-		p.ID = q["id"][0]
-		p.URL = anyurl + "&id=" + p.ID
-		if p.APIKey != "" && p.ShowFileInf {
-			if err := p.showFileInf(); err != nil {
-				return err
-			}
-			return nil
-		}
-	} else {
-		folder := regexp.MustCompile(`google\.com\/drive\/folders\/([a-zA-Z0-9-_]+)`)
-		if folder.MatchString(s) {
-			p.DlFolder = true
-			res := folder.FindAllStringSubmatch(s, -1)
-			p.SearchID = res[0][1]
-			if p.APIKey != "" {
-				err = p.getFilesFromFolder()
-				if err != nil {
-					return err
-				}
-			} else {
-				return errors.New("please use API key to download files in a folder")
-			}
-		} else {
-			return errors.New("URL is wrong")
-		}
-	}
-	return nil
-}
+	jsonOutput := c.Bool("json")
+	disp := c.Bool("NoProgress") || jsonOutput
 
-// download : Main method of download.
-func (p *Para) download(url string) error {
-	var err error
-	err = p.checkURL(url)
+	concurrencyOpt, batchSize, err := parseConcurrency(c.String("concurrency"), c.Int("concurrency-min"), c.Int("concurrency-max"))
 	if err != nil {
 		return err
 	}
-	if p.APIKey != "" && p.ShowFileInf {
-		return nil
-	} else if p.APIKey == "" && p.ShowFileInf {
-		return errors.New("when you want to use the option '--fileinf', please use API key")
-	} else if p.APIKey != "" && p.DlFolder {
-		return nil
-	}
-
-	p.Client = p.getHTTPClient()
 
-	res, err := p.fetch(p.URL)
-	if err != nil {
-		return err
-	}
-	if res.StatusCode == 200 {
-		_, chk := res.Header["Content-Disposition"]
-		if chk {
-			return p.saveFile(res)
-		}
-		if err := p.getURLFromHTML(res); err != nil {
+	var limitRate, limitRateFile int64
+	if s := c.String("limit-rate"); s != "" {
+		if limitRate, err = goodls.ParseRate(s); err != nil {
 			return err
 		}
-		if len(p.URLForLargeFile) == 0 && p.Kind == "file" {
-			return fmt.Errorf("file ID [ %s ] is not shared, while the file is existing", p.ID)
-		} else if len(p.URLForLargeFile) == 0 && p.Kind != "file" {
-			return p.saveFile(res)
-		} else {
-			if p.APIKey != "" && p.Resumabledownload != "" {
-				p.DownloadBytes, err = getDownloadBytes(p.Resumabledownload)
-				if err != nil {
-					return err
-				}
-				return p.resumableDownload()
-			}
-			return p.downloadLargeFile()
-		}
 	}
-	return fmt.Errorf("file ID [ %s ] cannot be downloaded as [ %s ]", p.ID, p.Ext)
-}
-
-// handler : Initialize of "Para".
-func handler(c *cli.Context) error {
-	var err error
-	workdir := c.String("directory")
-	if workdir == "" {
-		workdir, err = filepath.Abs(".")
-		if err != nil {
+	if s := c.String("limit-rate-file"); s != "" {
+		if limitRateFile, err = goodls.ParseRate(s); err != nil {
 			return err
 		}
 	}
 
-	concurrency := c.Int("concurrency")
-	if concurrency <= 0 {
-		concurrency = 5
-	}
-
-	conflict := strings.ToLower(c.String("conflict"))
-	if c.Bool("overwrite") {
-		conflict = "overwrite"
-	} else if c.Bool("skip") {
-		conflict = "skip"
-	}
-
-	switch conflict {
-	case "prompt", "skip", "overwrite", "newer", "rename":
-		// valid
-	default:
-		return fmt.Errorf("invalid conflict strategy: %s", conflict)
-	}
-
-	disp := c.Bool("NoProgress")
-	if c.Bool("json") {
-		disp = true
-	}
-
-	p := &Para{
-		Disp:              disp,
-		DownloadBytes:     -1,
-		Ext:               c.String("extension"),
-		OverWrite:         c.Bool("overwrite"),
-		Resumabledownload: c.String("resumabledownload"),
-		ShowFileInf:       c.Bool("fileinf"),
-		Skip:              c.Bool("skip"),
-		SkipError:         c.Bool("skiperror"),
-		WorkDir:           workdir,
-		DlFolder:          false,
-		Concurrency:       concurrency,
-		ConflictStrategy:  conflict,
-		InputtedMimeType: func(mime string) []string {
-			if mime != "" {
-				return regexp.MustCompile(`\s*,\s*`).Split(mime, -1)
+	var mimeTypes []string
+	if mime := c.String("mimetype"); mime != "" {
+		mimeTypes = regexp.MustCompile(`\s*,\s*`).Split(mime, -1)
+	}
+
+	var mu sync.Mutex
+	results := []goodls.Result{}
+	opts := []goodls.Option{
+		goodls.WithProgress(!disp),
+		goodls.WithExtension(c.String("extension")),
+		goodls.WithDefaultExtension("pdf"),
+		goodls.WithResumableDownload(c.String("resumabledownload")),
+		goodls.WithResumeUntilDone(c.Bool("resume-until-done")),
+		goodls.WithFileInfo(c.Bool("fileinf")),
+		goodls.WithSkipError(c.Bool("skiperror")),
+		goodls.WithDirectory(workdir),
+		concurrencyOpt,
+		goodls.WithConnections(c.Int("connections")),
+		goodls.WithVerify(c.Bool("verify")),
+		goodls.WithForce(c.Bool("force")),
+		goodls.WithRateLimit(limitRate),
+		goodls.WithFileRateLimit(limitRateFile),
+		goodls.WithConflict(conflict),
+		goodls.WithMimeTypes(mimeTypes...),
+		goodls.WithNotCreateTopDirectory(c.Bool("notcreatetopdirectory")),
+		goodls.WithPreserveTimes(!c.Bool("no-preserve-times")),
+		goodls.WithXattr(c.Bool("xattr")),
+		goodls.WithProxy(c.String("proxy")),
+		goodls.WithEndpoints(goodls.Endpoints{
+			Drive: c.String("drive-endpoint"),
+			Docs:  c.String("docs-endpoint"),
+			API:   c.String("api-endpoint"),
+		}),
+		goodls.WithVerbose(c.Bool("verbose")),
+		goodls.WithRetry(c.Int("retry")),
+		goodls.WithRetryDelay(time.Duration(c.Int("retry-delay")) * time.Second),
+		goodls.WithRetryMaxElapsed(time.Duration(c.Int("retry-max-time")) * time.Second),
+		goodls.WithWaitQuota(waitQuota(c.Bool("wait-quota"))),
+		goodls.WithExtract(c.Bool("extract"), c.String("extract-dir")),
+		goodls.WithExtractRemove(c.Bool("extract-remove")),
+		goodls.WithStallTimeout(time.Duration(c.Int("stall-timeout")) * time.Second),
+		goodls.WithConnectTimeout(time.Duration(c.Int("connect-timeout")) * time.Second),
+		goodls.WithTLSHandshakeTimeout(time.Duration(c.Int("tls-timeout")) * time.Second),
+		goodls.WithResponseHeaderTimeout(time.Duration(c.Int("response-timeout")) * time.Second),
+		goodls.WithMaxConnsPerHost(c.Int("max-conns-per-host")),
+		goodls.WithOnResult(func(r goodls.Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+			if disp && !jsonOutput {
+				printResult(resultOut, r)
 			}
-			return nil
-		}(c.String("mimetype")),
-		Notcreatetopdirectory: c.Bool("notcreatetopdirectory"),
-		Proxy:                 c.String("proxy"),
-		Verbose:               c.Bool("verbose"),
-		Retry:                 c.Int("retry"),
-		RetryDelay:            c.Int("retry-delay"),
-		JSONOutput:            c.Bool("json"),
-		ResultJSONs:           &[]string{},
-		mu:                    &sync.Mutex{},
+		}),
 	}
 
 	ignoreAPIKey := c.Bool("no-apikey")
 	rawKey := c.String("apikey")
 	envv := os.Getenv(envval)
-	var apiKeySource string
+	var apiKey, apiKeySource string
 
 	if ignoreAPIKey {
-		p.APIKey = ""
 		fmt.Fprintf(os.Stderr, "[*] API Key Explicitly Ignored via --no-apikey flag. Running in anonymous access mode.\n")
 	} else {
 		if rawKey != "" {
-			p.APIKey = strings.TrimSpace(rawKey)
+			apiKey = strings.TrimSpace(rawKey)
 			apiKeySource = "CLI Flag (--apikey / --key)"
 		} else if envv != "" && strings.TrimSpace(envv) != "" {
-			p.APIKey = strings.TrimSpace(envv)
+			apiKey = strings.TrimSpace(envv)
 			apiKeySource = fmt.Sprintf("Environment Variable (%s)", envval)
 		}
 
-		if p.APIKey != "" {
-			maskedKey := p.APIKey
+		if apiKey != "" {
+			maskedKey := apiKey
 			if len(maskedKey) > 8 {
 				maskedKey = maskedKey[:4] + strings.Repeat("*", len(maskedKey)-8) + maskedKey[len(maskedKey)-4:]
 			} else {
@@ -760,15 +187,17 @@ func handler(c *cli.Context) error {
 			fmt.Fprintf(os.Stderr, "[*] No API Key provided. Running in anonymous access mode.\n")
 		}
 	}
+	opts = append(opts, goodls.WithAPIKey(apiKey))
 
-	if !p.Disp {
-		p.Progress = mpb.New(mpb.WithWidth(60))
+	if toStdout {
+		opts = append(opts, goodls.WithOutput(os.Stdout))
 	}
 
-	urlFlag := c.String("url")
 	if urlFlag != "" {
-		p.Filename = c.String("filename")
-		err = p.download(urlFlag)
+		opts = append(opts, goodls.WithFilename(filename))
+		d := goodls.New(opts...)
+		_, err = d.DownloadURL(c.Context, urlFlag)
+		d.Close()
 		if err != nil {
 			return err
 		}
@@ -792,41 +221,75 @@ func handler(c *cli.Context) error {
 			return fmt.Errorf("no URL data. Please check help\n\n $ %s --help", appname)
 		}
 
-		sem := make(chan struct{}, p.Concurrency)
-		eg, _ := errgroup.WithContext(context.Background())
+		d := goodls.New(opts...)
+		// The number of concurrent file downloads is limited by the Downloader. This only bounds the URLs in flight.
+		sem := make(chan struct{}, batchSize)
+		eg, ctx := errgroup.WithContext(c.Context)
 		for _, u := range urls {
 			u := u
 			eg.Go(func() error {
-				sem <- struct{}{}
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 				defer func() { <-sem }()
 
-				workerP := p.Clone()
-				workerP.Filename = ""
-				err := workerP.download(u)
-				if err != nil {
+				if _, err := d.DownloadURL(ctx, u); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
 					fmt.Fprintf(os.Stderr, "## Skipped: Error: %v\n", err)
 				}
 				return nil
 			})
 		}
-		eg.Wait()
-	}
-
-	if p.Progress != nil {
-		p.Progress.Wait()
+		err = eg.Wait()
+		d.Close()
+		if err != nil {
+			return err
+		}
 	}
 
-	if p.JSONOutput && !p.MCPMode {
-		fmt.Printf("[%s]\n", strings.Join(*p.ResultJSONs, ","))
-	} else if !p.Disp && !p.MCPMode {
-		for _, jsonRes := range *p.ResultJSONs {
-			fmt.Println(jsonRes)
+	if jsonOutput {
+		r, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(resultOut, "%s\n", r)
+	} else if !disp {
+		for _, r := range results {
+			printResult(resultOut, r)
 		}
 	}
 
 	return nil
 }
 
+// parseConcurrency : Parse '--concurrency'. The returned size is the maximum number of concurrent downloads.
+func parseConcurrency(s string, lo, hi int) (goodls.Option, int, error) {
+	if strings.EqualFold(s, "auto") {
+		lo = max(lo, 1)
+		hi = max(hi, lo)
+		return goodls.WithAdaptiveConcurrency(lo, hi), hi, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return nil, 0, fmt.Errorf("invalid concurrency: %s. Use a positive number or 'auto'", s)
+	}
+	return goodls.WithConcurrency(n), n, nil
+}
+
+// printResult : Print a result as a line of JSON to w.
+func printResult(w io.Writer, r goodls.Result) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "%s\n", b)
+}
+
 // createHelp : Create help document using cli v2.
 func createHelp() *cli.App {
 	// Override the default version flag alias to free up '-v' for verbose logging.
@@ -846,9 +309,15 @@ func createHelp() *cli.App {
 				Name:  "mcp",
 				Usage: "Run the tool as an MCP (Model Context Protocol) server over stdio",
 				Action: func(c *cli.Context) error {
-					return RunMCP()
+					return RunMCP(c.Context)
 				},
 			},
+			{
+				Name:      "cat",
+				Usage:     "Write a shared file to stdout for piping, e.g. 'goodls cat URL | tar xz'. The progress is shown on stderr.",
+				ArgsUsage: "URL",
+				Action:    catHandler,
+			},
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -859,14 +328,18 @@ func createHelp() *cli.App {
 			&cli.StringFlag{
 				Name:    "extension",
 				Aliases: []string{"e"},
-				Usage:   "Extension of output file. This is for only Google Docs (Spreadsheet, Document, Presentation).",
-				Value:   "pdf",
+				Usage:   "Extension of output file. This is for only Google Docs (Spreadsheet, Document, Presentation). Defaults to the format in the URL (e.g. 'export?format=csv'), or 'pdf'.",
 			},
 			&cli.StringFlag{
 				Name:    "filename",
 				Aliases: []string{"f"},
 				Usage:   "Filename of file which is output. When this was not used, the original filename on Google Drive is used.",
 			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"O"},
+				Usage:   "Path of the downloaded file. '-O -' writes the file to stdout for piping; the progress and the results go to stderr, and existing files are not checked. ('-o' is the legacy '--overwrite'.)",
+			},
 			&cli.StringFlag{
 				Name:    "mimetype",
 				Aliases: []string{"m"},
@@ -881,7 +354,12 @@ func createHelp() *cli.App {
 			&cli.StringFlag{
 				Name:    "resumabledownload",
 				Aliases: []string{"r"},
-				Usage:   "File is downloaded as the resumable download. For example, when '-r 1m' is used, the size of 1 MB is downloaded and create new file or append the existing file. API key is required.",
+				Usage:   "File is downloaded as the resumable download. For example, when '-r 1m' is used, the size of 1 MB is downloaded and create new file or append the existing file. Without an API key, the chunks are requested from the anonymous download URL.",
+			},
+			&cli.BoolFlag{
+				Name:    "resume-until-done",
+				Aliases: []string{"yes"},
+				Usage:   "With '-r', download the chunks one after another without prompting until the file is complete, and verify its md5. Failed chunks are retried with '--retry'.",
 			},
 			&cli.BoolFlag{
 				Name:    "NoProgress",
@@ -923,16 +401,56 @@ func createHelp() *cli.App {
 				Aliases: []string{"ntd"},
 				Usage:   "When this option is NOT used (default situation), when a folder including subfolders is downloaded, the top folder which is downloaded is created as the top directory under the working directory.",
 			},
+			&cli.BoolFlag{
+				Name:  "no-preserve-times",
+				Usage: "Keep the time of the download as the modified time of the files and directories instead of modifiedTime on Google Drive.",
+			},
+			&cli.BoolFlag{
+				Name:  "xattr",
+				Usage: "Record the file ID, md5, URL, modifiedTime and mimeType of every saved file in its extended attributes user.goodls.* (Linux).",
+			},
 			&cli.BoolFlag{
 				Name:    "skiperror",
 				Aliases: []string{"se"},
 				Usage:   "When the files are downloaded from the folder, if an error occurs, the error is skipped by this option.",
 			},
-			&cli.IntFlag{
+			&cli.StringFlag{
 				Name:    "concurrency",
 				Aliases: []string{"c"},
-				Usage:   "Number of concurrent downloads when fetching multiple files (e.g. from a folder or stdin).",
-				Value:   5,
+				Usage:   "Number of concurrent downloads when fetching multiple files (e.g. from a folder or stdin). 'auto' adapts it between --concurrency-min and --concurrency-max, backing off when Google Drive throttles.",
+				Value:   "5",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency-min",
+				Usage: "Lower bound of '--concurrency auto'.",
+				Value: 1,
+			},
+			&cli.IntFlag{
+				Name:  "concurrency-max",
+				Usage: "Upper bound of '--concurrency auto'.",
+				Value: 16,
+			},
+			&cli.IntFlag{
+				Name:    "connections",
+				Aliases: []string{"cn"},
+				Usage:   "Number of connections for downloading one large file in parallel byte ranges. 1 disables it.",
+				Value:   4,
+			},
+			&cli.StringFlag{
+				Name:  "limit-rate",
+				Usage: "Limit the total bandwidth of all concurrent downloads, e.g. '5M' (bytes per second, K/M/G are powers of 1024).",
+			},
+			&cli.StringFlag{
+				Name:  "limit-rate-file",
+				Usage: "Limit the bandwidth of each file, e.g. '1M'.",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Only warn instead of aborting when the free disk space is less than the size of the download.",
+			},
+			&cli.BoolFlag{
+				Name:  "verify",
+				Usage: "Verify each file with md5Checksum and sha256Checksum of Drive API and download it again on a mismatch. API key is required to retrieve the checksums.",
 			},
 			&cli.StringFlag{
 				Name:    "proxy",
@@ -946,30 +464,158 @@ func createHelp() *cli.App {
 			},
 			&cli.IntFlag{
 				Name:  "retry",
-				Usage: "Max retry attempts for network errors.",
+				Usage: "Max retry attempts for network errors, 429 and 5xx. A broken download is resumed with a Range request.",
 				Value: 0,
 			},
 			&cli.IntFlag{
 				Name:  "retry-delay",
-				Usage: "Base delay in seconds for exponential backoff.",
+				Usage: "Base delay in seconds for exponential backoff. The delay is randomized (full jitter) and Retry-After of the server is honoured.",
 				Value: 2,
 			},
+			&cli.IntFlag{
+				Name:  "retry-max-time",
+				Usage: "Stop retrying a request after this number of seconds since its first attempt. 0 means no limit.",
+				Value: 600,
+			},
+			&cli.BoolFlag{
+				Name:  "wait-quota",
+				Usage: "When the download quota of a file is exceeded, poll it with backoff (from 1 minute up to 1 hour) until the quota resets.",
+			},
+			&cli.BoolFlag{
+				Name:  "extract",
+				Usage: "Unpack downloaded .zip, .tar, .tar.gz, .tgz, .tar.zst and .gz files into a directory named after the archive.",
+			},
+			&cli.StringFlag{
+				Name:  "extract-dir",
+				Usage: "Directory which '--extract' unpacks the archives into.",
+			},
+			&cli.BoolFlag{
+				Name:  "extract-remove",
+				Usage: "Remove an archive after '--extract' has unpacked it.",
+			},
+			&cli.IntFlag{
+				Name:  "stall-timeout",
+				Usage: "Abort a transfer when no bytes arrive for this number of seconds. It is resumed when '--retry' is set. 0 disables it.",
+				Value: 60,
+			},
+			&cli.IntFlag{
+				Name:  "connect-timeout",
+				Usage: "Timeout in seconds of establishing a connection. 0 means no timeout.",
+				Value: 30,
+			},
+			&cli.IntFlag{
+				Name:  "tls-timeout",
+				Usage: "Timeout in seconds of the TLS handshake. 0 means no timeout.",
+				Value: 10,
+			},
+			&cli.IntFlag{
+				Name:  "response-timeout",
+				Usage: "Timeout in seconds of waiting for the response headers. 0 means no timeout.",
+				Value: 60,
+			},
+			&cli.IntFlag{
+				Name:  "max-conns-per-host",
+				Usage: "Max number of connections to each host shared by all downloads. 0 means no limit.",
+				Value: 0,
+			},
 			&cli.BoolFlag{
 				Name:    "json",
 				Aliases: []string{"j"},
 				Usage:   "Output structured JSON results.",
 			},
+			// Hidden flags for pointing goodls at a mirror or a local fake Drive server.
+			&cli.StringFlag{
+				Name:    "drive-endpoint",
+				Usage:   "Base URL used instead of https://drive.google.com/.",
+				EnvVars: []string{envDriveEndpoint},
+				Hidden:  true,
+			},
+			&cli.StringFlag{
+				Name:    "docs-endpoint",
+				Usage:   "Base URL used instead of https://docs.google.com/.",
+				EnvVars: []string{envDocsEndpoint},
+				Hidden:  true,
+			},
+			&cli.StringFlag{
+				Name:    "api-endpoint",
+				Usage:   "Base URL used instead of https://www.googleapis.com/drive/v3/.",
+				EnvVars: []string{envAPIEndpoint},
+				Hidden:  true,
+			},
 		},
 		Action: handler,
 	}
 	return app
 }
 
+// Exit codes of the CLI. Each typed error of goodls has its own code so that wrappers do not need to match messages.
+const (
+	exitError             = 1
+	exitInvalidURL        = 2
+	exitNotShared         = 3
+	exitNotFound          = 4
+	exitQuotaExceeded     = 5
+	exitAPIKeyRequired    = 6
+	exitExportUnsupported = 7
+	exitEndpointChanged   = 8
+	exitConflictAborted   = 9
+	exitChecksumMismatch  = 10
+	exitRateLimited       = 11
+	exitInsufficientSpace = 12
+	exitUnsafeArchive     = 13
+	exitInterrupted       = 130
+)
+
+// waitQuota : First interval of polling a file whose download quota is exceeded.
+func waitQuota(wait bool) time.Duration {
+	if wait {
+		return time.Minute
+	}
+	return 0
+}
+
+// exitCode : Map an error to the exit code of the process.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, goodls.ErrInvalidURL):
+		return exitInvalidURL
+	case errors.Is(err, goodls.ErrNotShared):
+		return exitNotShared
+	case errors.Is(err, goodls.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, goodls.ErrQuotaExceeded):
+		return exitQuotaExceeded
+	case errors.Is(err, goodls.ErrAPIKeyRequired):
+		return exitAPIKeyRequired
+	case errors.Is(err, goodls.ErrExportUnsupported):
+		return exitExportUnsupported
+	case errors.Is(err, goodls.ErrEndpointChanged):
+		return exitEndpointChanged
+	case errors.Is(err, goodls.ErrConflictAborted):
+		return exitConflictAborted
+	case errors.Is(err, goodls.ErrChecksumMismatch):
+		return exitChecksumMismatch
+	case errors.Is(err, goodls.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, goodls.ErrInsufficientSpace):
+		return exitInsufficientSpace
+	case errors.Is(err, goodls.ErrUnsafeArchive):
+		return exitUnsafeArchive
+	}
+	return exitError
+}
+
 // Run : Main execution proxy for CLI commands
 func Run(args []string) {
+	// Ctrl-C and SIGTERM cancel the downloads in flight instead of killing the process midway.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	app := createHelp()
-	if err := app.Run(args); err != nil {
+	if err := app.RunContext(ctx, args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,276 @@
+package goodls
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"goodls/pkg/fakedrive"
+	"goodls/pkg/goodls"
+)
+
+// newFakeDrive : Start a fake Drive server with a shared folder and point the CLI at it.
+func newFakeDrive(t *testing.T) *fakedrive.Server {
+	t.Helper()
+	srv := fakedrive.New()
+	t.Cleanup(srv.Close)
+	srv.AddFile(fakedrive.File{ID: "small", Name: "small.txt", MimeType: "text/plain", Content: []byte("small content")})
+	srv.AddFile(fakedrive.File{ID: "quote", Name: `say "hi" \ bye.txt`, MimeType: "text/plain", Content: []byte("hi")})
+	srv.AddFile(fakedrive.File{ID: "large", Name: "large.bin", Content: make([]byte, 2*fakedrive.DefaultLargeFileSize)})
+	srv.AddFolder("top", "dataset", "")
+	srv.AddFolder("sub", "images", "top")
+	srv.AddFile(fakedrive.File{ID: "f1", Name: "readme.txt", MimeType: "text/plain", Content: []byte("readme"), Parents: []string{"top"}})
+	srv.AddFile(fakedrive.File{ID: "f2", Name: "a.png", MimeType: "image/png", Content: []byte("png"), Parents: []string{"sub"}})
+
+	t.Setenv(envval, "")
+	t.Setenv(envDriveEndpoint, srv.DriveURL())
+	t.Setenv(envDocsEndpoint, srv.DocsURL())
+	t.Setenv(envAPIEndpoint, srv.APIURL())
+	return srv
+}
+
+// runCLI : Run the CLI with args and return what it printed to stdout. stdin is used when it is not empty.
+func runCLI(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	origStdout, origStdin := os.Stdout, os.Stdin
+	t.Cleanup(func() { os.Stdout, os.Stdin = origStdout, origStdin })
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	if stdin != "" {
+		sr, sw, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			io.WriteString(sw, stdin)
+			sw.Close()
+		}()
+		os.Stdin = sr
+	}
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+
+	err = createHelp().RunContext(context.Background(), append([]string{appname}, args...))
+	w.Close()
+	os.Stdout, os.Stdin = origStdout, origStdin
+	return <-out, err
+}
+
+// parseResults : Parse the output of '--json'.
+func parseResults(t *testing.T, out string) []goodls.Result {
+	t.Helper()
+	var res []goodls.Result
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", out, err)
+	}
+	return res
+}
+
+func TestCLISingleFiles(t *testing.T) {
+	newFakeDrive(t)
+	for _, id := range []string{"small", "quote", "large"} {
+		dir := t.TempDir()
+		out, err := runCLI(t, "", "-u", "https://drive.google.com/file/d/"+id+"/view", "-d", dir, "-j", "-nk")
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		res := parseResults(t, out)
+		if len(res) != 1 {
+			t.Fatalf("%s: unexpected results %+v", id, res)
+		}
+		if _, err := os.Stat(filepath.Join(dir, res[0].Filename)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCLIExportFormatFromURL(t *testing.T) {
+	srv := newFakeDrive(t)
+	srv.AddFile(fakedrive.File{ID: "sheet", Name: "table", MimeType: "application/vnd.google-apps.spreadsheet"})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-u", "https://docs.google.com/spreadsheets/d/sheet/export?format=csv"}, "table.csv"},
+		{[]string{"-u", "https://docs.google.com/spreadsheets/d/sheet/export?format=csv", "-e", "xlsx"}, "table.xlsx"},
+		{[]string{"-u", "https://docs.google.com/spreadsheets/d/sheet/edit"}, "table.pdf"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		out, err := runCLI(t, "", append(tt.args, "-d", dir, "-j", "-nk")...)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if res := parseResults(t, out); len(res) != 1 || res[0].Filename != tt.want {
+			t.Errorf("%v: got %+v, want %s", tt.args, res, tt.want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, tt.want)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCLIStdout(t *testing.T) {
+	newFakeDrive(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, args := range [][]string{
+		{"-u", "https://drive.google.com/file/d/small/view", "-O", "-", "-nk"},
+		{"-nk", "cat", "https://drive.google.com/file/d/small/view"},
+	} {
+		out, err := runCLI(t, "", args...)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if out != "small content" {
+			t.Errorf("%v: stdout = %q", args, out)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files were created: %v", entries)
+	}
+
+	if _, err := runCLI(t, "", "-u", "https://drive.google.com/file/d/small/view", "-O", filepath.Join(dir, "copy.txt"), "-nk"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "copy.txt")); err != nil || string(b) != "small content" {
+		t.Errorf("copy.txt = %q, %v", b, err)
+	}
+}
+
+func TestCLIFolder(t *testing.T) {
+	newFakeDrive(t)
+	dir := t.TempDir()
+	out, err := runCLI(t, "", "-u", "https://drive.google.com/drive/folders/top", "-d", dir, "-j", "--key", "testkey", "-c", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := parseResults(t, out); len(res) != 2 {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	for _, name := range []string{"dataset/readme.txt", "dataset/images/a.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// A folder cannot be downloaded without an API key.
+	if _, err := runCLI(t, "", "-u", "https://drive.google.com/drive/folders/top", "-d", dir, "-nk"); err == nil {
+		t.Error("expected an error without an API key")
+	}
+}
+
+func TestCLIConflictSkip(t *testing.T) {
+	newFakeDrive(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "small.txt"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCLI(t, "", "-u", "https://drive.google.com/file/d/small/view", "-d", dir, "-np", "-nk", "--conflict", "skip"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "small.txt")); string(b) != "local" {
+		t.Errorf("the existing file was overwritten: %q", b)
+	}
+}
+
+func TestCLIBatchFromStdin(t *testing.T) {
+	srv := newFakeDrive(t)
+	srv.InjectFault(fakedrive.Fault{Match: "id=large", Status: 500})
+	dir := t.TempDir()
+	stdin := "https://drive.google.com/file/d/small/view\nhttps://drive.google.com/uc?export=download&id=large\nend\n"
+	out, err := runCLI(t, stdin, "-d", dir, "-j", "-nk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The failed URL is recorded with its error and the others are still downloaded.
+	res := parseResults(t, out)
+	if len(res) != 2 {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	for _, r := range res {
+		switch r.ID {
+		case "small":
+			if r.Filename != "small.txt" || r.Error != "" {
+				t.Errorf("unexpected result %+v", r)
+			}
+		case "large":
+			if r.Error == "" || r.URL != "https://drive.google.com/uc?export=download&id=large" {
+				t.Errorf("unexpected result %+v", r)
+			}
+		default:
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestMCPToolsCall(t *testing.T) {
+	newFakeDrive(t)
+	t.Cleanup(closeDownloaders)
+	// The calls share the Downloader, and each call has its own directory.
+	for _, dir := range []string{filepath.Join(t.TempDir(), "created"), filepath.Join(t.TempDir(), "other")} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		params, _ := json.Marshal(map[string]any{
+			"name":      "download",
+			"arguments": map[string]any{"url": "https://drive.google.com/file/d/small/view", "directory": dir},
+		})
+		go func() {
+			handleMCPRequest(context.Background(), w, MCPRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: params})
+			w.Close()
+		}()
+
+		line, err := bufio.NewReader(r).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(line, `"isError":false`) || !strings.Contains(line, "small.txt") {
+			t.Errorf("unexpected response %s", line)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "small.txt")); err != nil {
+			t.Error(err)
+		}
+	}
+	downloadersMu.Lock()
+	n := len(downloaders)
+	downloadersMu.Unlock()
+	if n != 1 {
+		t.Errorf("%d Downloaders were created, want 1", n)
+	}
+}
+
+func TestCLIExitCode(t *testing.T) {
+	newFakeDrive(t)
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-u", "https://example.com/file"}, exitInvalidURL},
+		{[]string{"-u", "https://drive.google.com/file/d/missing/view"}, exitNotFound},
+		{[]string{"-u", "https://drive.google.com/drive/folders/top"}, exitAPIKeyRequired},
+		{[]string{"-u", "https://drive.google.com/file/d/small/view", "--conflict", "wrong"}, exitError},
+	}
+	for _, tt := range tests {
+		_, err := runCLI(t, "", append(tt.args, "-d", dir, "-nk", "-np")...)
+		if got := exitCode(err); got != tt.want {
+			t.Errorf("%v: exit code = %d (%v), want %d", tt.args, got, err, tt.want)
+		}
+	}
+}
@@ -2,12 +2,16 @@ package goodls
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+
+	"goodls/pkg/goodls"
 )
 
 // MCPRequest defines the JSON-RPC request from an MCP client
@@ -29,8 +33,56 @@ type MCPResponse struct {
 // stdoutMu protects writing to the JSON-RPC output stream to prevent interleaving
 var stdoutMu sync.Mutex
 
-// RunMCP starts the stdio JSON-RPC server for Model Context Protocol
-func RunMCP() error {
+// inFlight holds the cancel functions of running requests keyed by their JSON-RPC ID
+var (
+	inFlightMu sync.Mutex
+	inFlight   = map[string]context.CancelFunc{}
+)
+
+// downloaders holds a Downloader for each proxy. The tool calls derive their Downloaders from it, so that they share
+// its pooled connections and its worker pool.
+var (
+	downloadersMu sync.Mutex
+	downloaders   = map[string]*goodls.Downloader{}
+)
+
+// sharedDownloader returns the Downloader of proxy, creating it on the first call
+func sharedDownloader(proxy string) *goodls.Downloader {
+	downloadersMu.Lock()
+	defer downloadersMu.Unlock()
+	d, ok := downloaders[proxy]
+	if !ok {
+		d = goodls.New(
+			goodls.WithHeadless(true), // Disables progress bars and prompts which would break JSON-RPC
+			goodls.WithProxy(proxy),
+		)
+		downloaders[proxy] = d
+	}
+	return d
+}
+
+// closeDownloaders closes the idle connections of the shared Downloaders
+func closeDownloaders() {
+	downloadersMu.Lock()
+	defer downloadersMu.Unlock()
+	for proxy, d := range downloaders {
+		d.Close()
+		delete(downloaders, proxy)
+	}
+}
+
+// requestKey normalizes a JSON-RPC ID (number or string) for the inFlight map
+func requestKey(id any) string {
+	return fmt.Sprintf("%v", id)
+}
+
+// RunMCP starts the stdio JSON-RPC server for Model Context Protocol.
+// Cancelling ctx aborts all running tool calls.
+func RunMCP(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer closeDownloaders()
+
 	// DANGER: If goodls writes anything to os.Stdout during MCP mode, it will corrupt the JSON-RPC stream.
 	// We MUST hijack os.Stdout and point it to os.Stderr for any rogue library logs.
 	originalStdout := os.Stdout
@@ -50,7 +102,23 @@ func RunMCP() error {
 		}
 
 		// Dispatch request to a goroutine so that long-running tools do not block ping/keep-alive messages
-		go handleMCPRequest(originalStdout, req)
+		reqCtx, reqCancel := context.WithCancel(ctx)
+		if req.ID != nil {
+			inFlightMu.Lock()
+			inFlight[requestKey(req.ID)] = reqCancel
+			inFlightMu.Unlock()
+		}
+		go func() {
+			defer func() {
+				if req.ID != nil {
+					inFlightMu.Lock()
+					delete(inFlight, requestKey(req.ID))
+					inFlightMu.Unlock()
+				}
+				reqCancel()
+			}()
+			handleMCPRequest(reqCtx, originalStdout, req)
+		}()
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -59,7 +127,7 @@ func RunMCP() error {
 	return nil
 }
 
-func handleMCPRequest(out *os.File, req MCPRequest) {
+func handleMCPRequest(ctx context.Context, out *os.File, req MCPRequest) {
 	switch req.Method {
 	case "initialize":
 		sendResponse(out, req.ID, map[string]any{
@@ -75,9 +143,24 @@ func handleMCPRequest(out *os.File, req MCPRequest) {
 	case "ping":
 		// Required by MCP to keep the connection alive
 		sendResponse(out, req.ID, map[string]any{})
-	case "notifications/initialized", "notifications/cancelled":
+	case "notifications/initialized":
 		// Ignore notifications (they have no ID and expect no response)
 		return
+	case "notifications/cancelled":
+		// The client gave up on a request. Abort its download; no response is sent for a cancelled request.
+		var params struct {
+			RequestID any `json:"requestId"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.RequestID == nil {
+			return
+		}
+		inFlightMu.Lock()
+		cancel, ok := inFlight[requestKey(params.RequestID)]
+		inFlightMu.Unlock()
+		if ok {
+			cancel()
+		}
+		return
 	case "tools/list":
 		sendResponse(out, req.ID, map[string]any{
 			"tools": []map[string]any{
@@ -87,13 +170,15 @@ func handleMCPRequest(out *os.File, req MCPRequest) {
 					"inputSchema": map[string]any{
 						"type": "object",
 						"properties": map[string]any{
-							"url":        map[string]any{"type": "string", "description": "Google Drive URL (file or folder)"},
-							"conflict":   map[string]any{"type": "string", "description": "Conflict resolution strategy: 'skip', 'overwrite', 'newer', 'rename'."},
-							"directory":  map[string]any{"type": "string", "description": "Target local directory to save the downloaded files."},
-							"apikey":     map[string]any{"type": "string", "description": "Optional API key for downloading folders."},
-							"proxy":      map[string]any{"type": "string", "description": "Optional HTTP/HTTPS proxy URL."},
-							"retry":      map[string]any{"type": "integer", "description": "Optional max retry attempts for downloads."},
-							"retryDelay": map[string]any{"type": "integer", "description": "Optional retry delay in seconds for exponential backoff."},
+							"url":           map[string]any{"type": "string", "description": "Google Drive URL (file or folder)"},
+							"conflict":      map[string]any{"type": "string", "description": "Conflict resolution strategy: 'skip', 'overwrite', 'newer', 'rename'."},
+							"directory":     map[string]any{"type": "string", "description": "Target local directory to save the downloaded files."},
+							"apikey":        map[string]any{"type": "string", "description": "Optional API key for downloading folders."},
+							"proxy":         map[string]any{"type": "string", "description": "Optional HTTP/HTTPS proxy URL."},
+							"retry":         map[string]any{"type": "integer", "description": "Optional max retry attempts for downloads."},
+							"retryDelay":    map[string]any{"type": "integer", "description": "Optional retry delay in seconds for exponential backoff."},
+							"limitRate":     map[string]any{"type": "string", "description": "Optional bandwidth limit of all files of this call, e.g. '5M' (bytes per second). It applies to this call only, so concurrent calls are limited separately."},
+							"limitRateFile": map[string]any{"type": "string", "description": "Optional bandwidth limit of each file, e.g. '1M' (bytes per second)."},
 						},
 						"required": []string{"url"},
 					},
@@ -110,13 +195,15 @@ func handleMCPRequest(out *os.File, req MCPRequest) {
 		var params struct {
 			Name      string `json:"name"`
 			Arguments struct {
-				URL        string `json:"url"`
-				Conflict   string `json:"conflict"`
-				Directory  string `json:"directory"`
-				APIKey     string `json:"apikey"`
-				Proxy      string `json:"proxy"`
-				Retry      int    `json:"retry"`
-				RetryDelay int    `json:"retryDelay"`
+				URL           string `json:"url"`
+				Conflict      string `json:"conflict"`
+				Directory     string `json:"directory"`
+				APIKey        string `json:"apikey"`
+				Proxy         string `json:"proxy"`
+				Retry         int    `json:"retry"`
+				RetryDelay    int    `json:"retryDelay"`
+				LimitRate     string `json:"limitRate"`
+				LimitRateFile string `json:"limitRateFile"`
 			} `json:"arguments"`
 		}
 		if err := json.Unmarshal(req.Params, &params); err != nil {
@@ -134,14 +221,27 @@ func handleMCPRequest(out *os.File, req MCPRequest) {
 			retryDelay = 2
 		}
 
-		executeToolDownload(out, req.ID, params.Arguments.URL, params.Arguments.Conflict, params.Arguments.Directory, params.Arguments.APIKey, params.Arguments.Proxy, params.Arguments.Retry, retryDelay)
+		var rates [2]int64
+		for i, rate := range []string{params.Arguments.LimitRate, params.Arguments.LimitRateFile} {
+			if rate == "" {
+				continue
+			}
+			r, err := goodls.ParseRate(rate)
+			if err != nil {
+				sendError(out, req.ID, -32602, "Invalid params", err.Error())
+				return
+			}
+			rates[i] = r
+		}
+
+		executeToolDownload(ctx, out, req.ID, params.Arguments.URL, params.Arguments.Conflict, params.Arguments.Directory, params.Arguments.APIKey, params.Arguments.Proxy, params.Arguments.Retry, retryDelay, rates[0], rates[1])
 
 	default:
 		sendError(out, req.ID, -32601, "Method not found", fmt.Sprintf("Unsupported method: %s", req.Method))
 	}
 }
 
-func executeToolDownload(out *os.File, reqID any, url, conflict, directory, apiKey, proxy string, retry, retryDelay int) {
+func executeToolDownload(ctx context.Context, out *os.File, reqID any, url, conflict, directory, apiKey, proxy string, retry, retryDelay int, limitRate, limitRateFile int64) {
 	if directory == "" {
 		directory, _ = filepath.Abs(".")
 	} else {
@@ -171,29 +271,38 @@ func executeToolDownload(out *os.File, reqID any, url, conflict, directory, apiK
 		apiKeyToUse = os.Getenv("GOODLS_APIKEY") // directly read instead of referencing unexported var cleanly
 	}
 
-	p := &Para{
-		Disp:             true, // Disables progress bar rendering which would break JSON-RPC
-		MCPMode:          true, // Enables aggressive fail-fast logic for prompts
-		DownloadBytes:    -1,
-		WorkDir:          directory,
-		Concurrency:      5,
-		ConflictStrategy: conflict,
-		APIKey:           apiKeyToUse,
-		Proxy:            proxy,
-		Retry:            retry,
-		RetryDelay:       retryDelay,
-		ResultJSONs:      &[]string{},
-		mu:               &sync.Mutex{},
+	// The connections of the proxy are shared with the other calls. The other options are those of this call.
+	d := sharedDownloader(proxy).With(
+		goodls.WithDirectory(directory),
+		goodls.WithConflict(goodls.ConflictStrategy(conflict)),
+		goodls.WithAPIKey(apiKeyToUse),
+		goodls.WithEndpoints(goodls.Endpoints{
+			Drive: os.Getenv(envDriveEndpoint),
+			Docs:  os.Getenv(envDocsEndpoint),
+			API:   os.Getenv(envAPIEndpoint),
+		}),
+		goodls.WithRetry(retry),
+		goodls.WithRetryDelay(time.Duration(retryDelay)*time.Second),
+		goodls.WithRateLimit(limitRate),
+		goodls.WithFileRateLimit(limitRateFile),
+	)
+	res, err := d.DownloadURL(ctx, url)
+	if ctx.Err() != nil {
+		// The request was cancelled by the client, which expects no response.
+		return
 	}
-
-	err := p.download(url)
+	details, _ := json.Marshal(res)
 	if err != nil {
 		// As per MCP spec, tool execution errors should be returned gracefully inside the result object with isError: true
+		text := err.Error()
+		if len(res) > 0 {
+			text += "\nDetails:\n" + string(details)
+		}
 		sendResponse(out, reqID, map[string]any{
 			"content": []map[string]any{
 				{
 					"type": "text",
-					"text": err.Error(),
+					"text": text,
 				},
 			},
 			"isError": true,
@@ -201,14 +310,9 @@ func executeToolDownload(out *os.File, reqID any, url, conflict, directory, apiK
 		return
 	}
 
-	var results []string
-	p.mu.Lock()
-	results = append(results, *p.ResultJSONs...)
-	p.mu.Unlock()
-
 	summary := "Download completed successfully."
-	if len(results) > 0 {
-		summary += "\nDetails:\n" + strings.Join(results, "\n")
+	if len(res) > 0 {
+		summary += "\nDetails:\n" + string(details)
 	}
 
 	sendResponse(out, reqID, map[string]any{
@@ -0,0 +1,619 @@
+/*
+Package fakedrive (fakedrive.go) :
+This is an httptest based fake of Google Drive for end-to-end tests of goodls.
+
+It serves the anonymous endpoint "uc?export=download" including the virus scan warning page of large files,
+the Docs export endpoints, and "files.get", "files.list" and "files.export" of Drive API v3.
+File contents are served with http.ServeContent, so Range requests are honoured.
+HTTP errors such as 429 and 5xx can be injected with Server.InjectFault.
+
+	srv := fakedrive.New()
+	defer srv.Close()
+	srv.AddFile(fakedrive.File{ID: "id1", Name: "sample.txt", Content: []byte("sample")})
+
+	d := goodls.New(goodls.WithEndpoints(goodls.Endpoints{
+		Drive: srv.DriveURL(),
+		Docs:  srv.DocsURL(),
+		API:   srv.APIURL(),
+	}))
+*/
+package fakedrive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// FolderMimeType : mimeType of folders on Google Drive.
+const FolderMimeType = "application/vnd.google-apps.folder"
+
+// DefaultLargeFileSize : Files of this size or larger are served behind the virus scan warning page.
+const DefaultLargeFileSize = 100 * 1024
+
+// File : A file or a folder on the fake Drive.
+type File struct {
+	ID       string
+	Name     string
+	MimeType string // Default is "application/octet-stream". Use FolderMimeType or AddFolder for folders.
+	Content  []byte
+	Parents  []string
+
+	// ModifiedTime is sent as "modifiedTime" and "Last-Modified". Default is the time when the file was added.
+	ModifiedTime time.Time
+
+	// NotShared redirects the anonymous endpoint to the sign-in page like accounts.google.com.
+	NotShared bool
+
+	// Exports holds the contents of Google Docs files keyed by the exported mimeType.
+	// When the requested mimeType is missing, a text derived from the name and the mimeType is served.
+	Exports map[string][]byte
+}
+
+// Fault : An injected error response.
+type Fault struct {
+	Match      string // The fault is applied to the requests whose path and query contain Match.
+	Status     int    // Status code of the response.
+	Count      int    // Number of requests to fail. 0 or less means every matched request.
+	RetryAfter string // Optional value of the "Retry-After" header.
+	Body       string // Optional body of the response.
+
+	// Partial serves the response normally but drops the connection after this number of bytes of the body.
+	// Status, RetryAfter and Body are not used when Partial is more than 0.
+	Partial int64
+
+	// Stall pauses the body for this duration after Partial bytes instead of dropping the connection.
+	// The pause ends early when the client goes away.
+	Stall time.Duration
+
+	// Corrupt serves the response normally but flips the bits of the first byte of the body.
+	// Status, RetryAfter and Body are not used when Corrupt is true.
+	Corrupt bool
+}
+
+// corruptWriter : ResponseWriter which flips the bits of the first byte.
+type corruptWriter struct {
+	http.ResponseWriter
+	done bool
+}
+
+// Write : Implement io.Writer.
+func (w *corruptWriter) Write(b []byte) (int, error) {
+	if !w.done && len(b) > 0 {
+		w.done = true
+		c := append([]byte{^b[0]}, b[1:]...)
+		return w.ResponseWriter.Write(c)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// partialWriter : ResponseWriter which drops the connection after n bytes.
+type partialWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+// Write : Implement io.Writer.
+func (w *partialWriter) Write(b []byte) (int, error) {
+	if int64(len(b)) > w.n {
+		w.ResponseWriter.Write(b[:w.n])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.n -= int64(len(b))
+	return w.ResponseWriter.Write(b)
+}
+
+// stallWriter : ResponseWriter which pauses for d after n bytes.
+type stallWriter struct {
+	http.ResponseWriter
+	n    int64
+	d    time.Duration
+	done <-chan struct{}
+}
+
+// Write : Implement io.Writer.
+func (w *stallWriter) Write(b []byte) (int, error) {
+	if w.d > 0 && int64(len(b)) > w.n {
+		head, err := w.ResponseWriter.Write(b[:w.n])
+		if err != nil {
+			return head, err
+		}
+		w.ResponseWriter.(http.Flusher).Flush()
+		select {
+		case <-time.After(w.d):
+		case <-w.done:
+		}
+		w.d = 0
+		n, err := w.ResponseWriter.Write(b[w.n:])
+		return head + n, err
+	}
+	w.n -= int64(len(b))
+	return w.ResponseWriter.Write(b)
+}
+
+// Server : The fake Drive server.
+type Server struct {
+	*httptest.Server
+
+	// LargeFileSize : Files of this size or larger need the confirmation of the virus scan warning page.
+	LargeFileSize int64
+
+	// IgnoreRange : Serve the whole content for Range requests like a server without the support of Range.
+	IgnoreRange bool
+
+	// LegacyConfirm : Serve the virus scan warning page on "uc" with a form submitted to "uc" again, as Google Drive did
+	// before large files were moved to "drive.usercontent.google.com/download".
+	LegacyConfirm bool
+
+	// NoDisposition : Serve the confirmed download of a large file without "Content-Disposition", so without its name.
+	NoDisposition bool
+
+	mu     sync.Mutex
+	files  map[string]*File
+	order  []string
+	faults []*Fault
+	hits   map[string]int
+	ranges map[string][]string
+}
+
+// New : Start a fake Drive server. Close must be called after use.
+func New() *Server {
+	s := &Server{
+		LargeFileSize: DefaultLargeFileSize,
+		files:         map[string]*File{},
+		hits:          map[string]int{},
+		ranges:        map[string][]string{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/uc", s.handleUC)
+	mux.HandleFunc("/download", s.handleUserContent)
+	mux.HandleFunc("/ServiceLogin", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, signInPage)
+	})
+	mux.HandleFunc("/docs/", s.handleDocs)
+	mux.HandleFunc("/drive/v3/files", s.handleList)
+	mux.HandleFunc("/drive/v3/files/", s.handleFile)
+	s.Server = httptest.NewServer(s.faultMiddleware(mux))
+	return s
+}
+
+// DriveURL : Base URL used instead of "https://drive.google.com/".
+func (s *Server) DriveURL() string {
+	return s.URL + "/"
+}
+
+// DocsURL : Base URL used instead of "https://docs.google.com/".
+func (s *Server) DocsURL() string {
+	return s.URL + "/docs/"
+}
+
+// APIURL : Base URL used instead of "https://www.googleapis.com/drive/v3/".
+func (s *Server) APIURL() string {
+	return s.URL + "/drive/v3/"
+}
+
+// AddFile : Add a file to the fake Drive.
+func (s *Server) AddFile(f File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.MimeType == "" {
+		f.MimeType = "application/octet-stream"
+	}
+	if f.ModifiedTime.IsZero() {
+		f.ModifiedTime = time.Now().Truncate(time.Second)
+	}
+	if _, ok := s.files[f.ID]; !ok {
+		s.order = append(s.order, f.ID)
+	}
+	s.files[f.ID] = &f
+}
+
+// AddFolder : Add a folder to the fake Drive. parent is empty for a top folder.
+func (s *Server) AddFolder(id, name, parent string) {
+	f := File{ID: id, Name: name, MimeType: FolderMimeType}
+	if parent != "" {
+		f.Parents = []string{parent}
+	}
+	s.AddFile(f)
+}
+
+// InjectFault : Add a fault. Faults are checked in the order of injection.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// Hits : Number of requests whose path and query contain match.
+func (s *Server) Hits(match string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k, v := range s.hits {
+		if strings.Contains(k, match) {
+			n += v
+		}
+	}
+	return n
+}
+
+// Ranges : "Range" headers of the requests whose path and query contain match.
+func (s *Server) Ranges(match string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ranges []string
+	for k, v := range s.ranges {
+		if strings.Contains(k, match) {
+			ranges = append(ranges, v...)
+		}
+	}
+	return ranges
+}
+
+// faultMiddleware : Count the requests and answer with the injected faults.
+func (s *Server) faultMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.RequestURI()
+		s.mu.Lock()
+		s.hits[key]++
+		if rng := r.Header.Get("Range"); rng != "" {
+			s.ranges[key] = append(s.ranges[key], rng)
+		}
+		if s.IgnoreRange {
+			r.Header.Del("Range")
+		}
+		var fault *Fault
+		for i, f := range s.faults {
+			if strings.Contains(key, f.Match) {
+				fault = f
+				if f.Count > 0 {
+					f.Count--
+					if f.Count == 0 {
+						s.faults = append(s.faults[:i], s.faults[i+1:]...)
+					}
+				}
+				break
+			}
+		}
+		s.mu.Unlock()
+		if fault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if fault.Stall > 0 {
+			next.ServeHTTP(&stallWriter{ResponseWriter: w, n: fault.Partial, d: fault.Stall, done: r.Context().Done()}, r)
+			return
+		}
+		if fault.Partial > 0 {
+			next.ServeHTTP(&partialWriter{ResponseWriter: w, n: fault.Partial}, r)
+			return
+		}
+		if fault.Corrupt {
+			next.ServeHTTP(&corruptWriter{ResponseWriter: w}, r)
+			return
+		}
+		if fault.RetryAfter != "" {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		w.WriteHeader(fault.Status)
+		fmt.Fprint(w, fault.Body)
+	})
+}
+
+// file : Retrieve a file by ID.
+func (s *Server) file(id string) (*File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[id]
+	return f, ok
+}
+
+// md5Checksum : md5 of the content.
+func md5Checksum(b []byte) string {
+	h := md5.Sum(b)
+	return hex.EncodeToString(h[:])
+}
+
+// isGoogleDocs : Check whether the file is a Google Docs file which can only be exported.
+func (f *File) isGoogleDocs() bool {
+	return strings.HasPrefix(f.MimeType, "application/vnd.google-apps.")
+}
+
+// export : Content of the file exported as mimeType.
+func (f *File) export(mimeType string) []byte {
+	if b, ok := f.Exports[mimeType]; ok {
+		return b
+	}
+	return []byte(fmt.Sprintf("%s exported as %s", f.Name, mimeType))
+}
+
+// driveFile : Resource representation of Drive API.
+func (f *File) driveFile() *drive.File {
+	df := &drive.File{
+		Id:           f.ID,
+		Name:         f.Name,
+		MimeType:     f.MimeType,
+		Parents:      f.Parents,
+		ModifiedTime: f.ModifiedTime.UTC().Format(time.RFC3339),
+		CreatedTime:  f.ModifiedTime.UTC().Format(time.RFC3339),
+		Shared:       !f.NotShared,
+	}
+	if !f.isGoogleDocs() {
+		df.Size = int64(len(f.Content))
+		df.Md5Checksum = md5Checksum(f.Content)
+		sha := sha256.Sum256(f.Content)
+		df.Sha256Checksum = hex.EncodeToString(sha[:])
+	}
+	return df
+}
+
+// serveContent : Serve the content as an attachment. Range requests are handled by http.ServeContent.
+func serveContent(w http.ResponseWriter, r *http.Request, name, mimeType string, modTime time.Time, content []byte) {
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(content))
+}
+
+// writeJSON : Write v as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError : Write an error in the format of Google APIs.
+func writeAPIError(w http.ResponseWriter, status int, reason, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"code":    status,
+			"message": message,
+			"errors":  []map[string]any{{"domain": "global", "reason": reason, "message": message}},
+		},
+	})
+}
+
+// HTML pages of the anonymous endpoint.
+var (
+	virusScanPage = template.Must(template.New("virusscan").Parse(`<!DOCTYPE html><html><head><title>Google Drive - Virus scan warning</title></head><body>
+<div class="uc-main"><div id="uc-text"><p class="uc-warning-caption">Google Drive can't scan this file for viruses.</p>
+<p class="uc-warning-subcaption"><span class="uc-name-size"><a href="/open?id={{.ID}}">{{.Name}}</a> ({{.Size}})</span> is too large for Google to scan for viruses. Would you still like to download this file?</p>
+<form id="download-form" action="{{.Action}}" method="get"><input type="submit" id="uc-download-link" class="goog-inline-block jfk-button jfk-button-action" value="Download anyway"/>
+<input type="hidden" name="id" value="{{.ID}}"><input type="hidden" name="export" value="download"><input type="hidden" name="confirm" value="t"><input type="hidden" name="uuid" value="{{.UUID}}">{{if .AT}}<input type="hidden" name="at" value="{{.AT}}">{{end}}</form></div></div></body></html>`))
+
+	signInPage   = `<!DOCTYPE html><html><head><title>Google Drive - Sign in</title></head><body><div>Sign in to continue to Google Drive</div></body></html>`
+	notFoundPage = `<!DOCTYPE html><html><head><title>Google Drive - Page Not Found</title></head><body><div>Sorry, the file you have requested does not exist.</div></body></html>`
+)
+
+// handleUC : Anonymous download of "uc?export=download&id=###".
+func (s *Server) handleUC(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, ok := s.file(q.Get("id"))
+	if !ok || f.MimeType == FolderMimeType {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, notFoundPage)
+		return
+	}
+	if f.NotShared {
+		http.Redirect(w, r, "/ServiceLogin?continue="+url.QueryEscape(r.URL.String()), http.StatusFound)
+		return
+	}
+	if int64(len(f.Content)) >= s.LargeFileSize && (q.Get("confirm") == "" || q.Get("uuid") != uuidOf(f)) {
+		if !s.LegacyConfirm {
+			http.Redirect(w, r, "/download?id="+url.QueryEscape(f.ID)+"&export=download", http.StatusSeeOther)
+			return
+		}
+		s.writeVirusScanPage(w, f, s.URL+"/uc", "")
+		return
+	}
+	serveContent(w, r, f.Name, f.MimeType, f.ModifiedTime, f.Content)
+}
+
+// handleUserContent : Download of "drive.usercontent.google.com/download?id=###&export=download". A large file needs
+// "confirm", "uuid" and "at" of its virus scan warning page.
+func (s *Server) handleUserContent(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, ok := s.file(q.Get("id"))
+	if !ok || f.MimeType == FolderMimeType {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, notFoundPage)
+		return
+	}
+	if f.NotShared {
+		http.Redirect(w, r, "/ServiceLogin?continue="+url.QueryEscape(r.URL.String()), http.StatusFound)
+		return
+	}
+	if int64(len(f.Content)) >= s.LargeFileSize && (q.Get("confirm") == "" || q.Get("uuid") != uuidOf(f) || q.Get("at") != atOf(f)) {
+		s.writeVirusScanPage(w, f, s.URL+"/download", atOf(f))
+		return
+	}
+	if s.NoDisposition {
+		w.Header().Set("Content-Type", f.MimeType)
+		http.ServeContent(w, r, "", f.ModifiedTime, bytes.NewReader(f.Content))
+		return
+	}
+	serveContent(w, r, f.Name, f.MimeType, f.ModifiedTime, f.Content)
+}
+
+// writeVirusScanPage : Write the virus scan warning page of f whose form is submitted to action.
+func (s *Server) writeVirusScanPage(w http.ResponseWriter, f *File, action, at string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	virusScanPage.Execute(w, map[string]any{
+		"ID":     f.ID,
+		"Name":   f.Name,
+		"Size":   strconv.Itoa(len(f.Content)/1024) + "K",
+		"Action": action,
+		"UUID":   uuidOf(f),
+		"AT":     at,
+	})
+}
+
+// uuidOf : Token of the virus scan warning page of the file.
+func uuidOf(f *File) string {
+	return md5Checksum([]byte("uuid:" + f.ID))[:16]
+}
+
+// atOf : "at" token of the virus scan warning page of drive.usercontent.google.com.
+func atOf(f *File) string {
+	return "AKdTe" + md5Checksum([]byte("at:" + f.ID))[:12] + ":1700000000000"
+}
+
+// docsExportPath : "/docs/{kind}/d/{id}/export?format={ext}" or "/docs/presentation/d/{id}/export/{ext}".
+var docsExportPath = regexp.MustCompile(`^/docs/(\w+)/d/([\w-]+)/export(?:/(\w+))?$`)
+
+// docsExtToMime : mimeTypes of the formats of the Docs export endpoints.
+var docsExtToMime = map[string]string{
+	"pdf":  "application/pdf",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"odt":  "application/vnd.oasis.opendocument.text",
+	"ods":  "application/x-vnd.oasis.opendocument.spreadsheet",
+	"csv":  "text/csv",
+	"tsv":  "text/tab-separated-values",
+	"txt":  "text/plain",
+	"html": "text/html",
+	"zip":  "application/zip",
+	"epub": "application/epub+zip",
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"svg":  "image/svg+xml",
+}
+
+// handleDocs : Export of Google Docs files.
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	m := docsExportPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, ok := s.file(m[2])
+	if !ok || !f.isGoogleDocs() || f.NotShared {
+		http.NotFound(w, r)
+		return
+	}
+	ext := m[3]
+	if ext == "" {
+		ext = r.URL.Query().Get("format")
+	}
+	mimeType, ok := docsExtToMime[ext]
+	if !ok {
+		http.Error(w, "unsupported export format", http.StatusBadRequest)
+		return
+	}
+	serveContent(w, r, f.Name+"."+ext, mimeType, f.ModifiedTime, f.export(mimeType))
+}
+
+// handleFile : "files.get", "files.get?alt=media" and "files.export" of Drive API.
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("key") == "" {
+		writeAPIError(w, http.StatusForbidden, "forbidden", "Method doesn't allow unregistered callers (callers without established identity). Please use API Key or other form of API consumer identity to call this API.")
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")
+	id, action, _ := strings.Cut(rest, "/")
+	f, ok := s.file(id)
+	if !ok || f.NotShared {
+		writeAPIError(w, http.StatusNotFound, "notFound", "File not found: "+id+".")
+		return
+	}
+	switch {
+	case action == "export":
+		if !f.isGoogleDocs() {
+			writeAPIError(w, http.StatusForbidden, "fileNotExportable", "Export only supports Docs Editors files.")
+			return
+		}
+		mimeType := r.URL.Query().Get("mimeType")
+		w.Header().Set("Content-Type", mimeType)
+		w.Header().Set("Content-Disposition", "attachment")
+		w.Write(f.export(mimeType))
+	case action != "":
+		http.NotFound(w, r)
+	case r.URL.Query().Get("alt") == "media":
+		if f.isGoogleDocs() {
+			writeAPIError(w, http.StatusForbidden, "fileNotDownloadable", "Only files with binary content can be downloaded. Use Export with Docs Editors files.")
+			return
+		}
+		w.Header().Set("Content-Type", f.MimeType)
+		w.Header().Set("Content-Disposition", "attachment")
+		http.ServeContent(w, r, f.Name, f.ModifiedTime, bytes.NewReader(f.Content))
+	default:
+		writeJSON(w, http.StatusOK, f.driveFile())
+	}
+}
+
+// Patterns of the query of "files.list" used by go-getfilelist.
+var (
+	parentsQuery  = regexp.MustCompile(`'([^']+)' in parents`)
+	folderQuery   = regexp.MustCompile(`mimeType\s*(!?=)\s*'` + regexp.QuoteMeta(FolderMimeType) + `'`)
+	mimeTypeQuery = regexp.MustCompile(`mimeType='([^']+)'`)
+)
+
+// handleList : "files.list" of Drive API. Only the queries used by go-getfilelist are supported.
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("key") == "" {
+		writeAPIError(w, http.StatusForbidden, "forbidden", "The request is missing a valid API key.")
+		return
+	}
+	q := r.URL.Query().Get("q")
+	var parent string
+	if m := parentsQuery.FindStringSubmatch(q); m != nil {
+		parent = m[1]
+	}
+	onlyFolders, noFolders := false, false
+	if m := folderQuery.FindStringSubmatch(q); m != nil {
+		onlyFolders = m[1] == "="
+		noFolders = m[1] == "!="
+	}
+	var mimeTypes []string
+	for _, m := range mimeTypeQuery.FindAllStringSubmatch(q, -1) {
+		if m[1] != FolderMimeType {
+			mimeTypes = append(mimeTypes, m[1])
+		}
+	}
+
+	s.mu.Lock()
+	list := &drive.FileList{Files: []*drive.File{}}
+	for _, id := range s.order {
+		f := s.files[id]
+		isFolder := f.MimeType == FolderMimeType
+		switch {
+		case parent != "" && !contains(f.Parents, parent),
+			onlyFolders && !isFolder,
+			noFolders && isFolder,
+			len(mimeTypes) > 0 && !contains(mimeTypes, f.MimeType):
+			continue
+		}
+		list.Files = append(list.Files, f.driveFile())
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, list)
+}
+
+// contains : Check whether list includes v.
+func contains(list []string, v string) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package fakedrive
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestRangeAndFault(t *testing.T) {
+	srv := New()
+	defer srv.Close()
+	srv.AddFile(File{ID: "f", Name: "f.bin", Content: []byte("0123456789")})
+	srv.InjectFault(Fault{Match: "/drive/v3/files/f", Status: 429, Count: 1, RetryAfter: "3"})
+
+	get := func(rng string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.APIURL()+"files/f?alt=media&key=k", nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	if res := get(""); res.StatusCode != 429 || res.Header.Get("Retry-After") != "3" {
+		t.Fatalf("fault was not injected: %d %q", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	res := get("bytes=4-")
+	b, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusPartialContent || string(b) != "456789" {
+		t.Errorf("range response = %d %q", res.StatusCode, b)
+	}
+	if n := srv.Hits("/drive/v3/files/f"); n != 2 {
+		t.Errorf("hits = %d, want 2", n)
+	}
+}
@@ -0,0 +1,839 @@
+package goodls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+	"golang.org/x/term"
+)
+
+// para : Structure for each parameter
+type para struct {
+	APIKey                string
+	Client                *http.Client // Client of the current download. It shares the transport of the Downloader.
+	ContentType           string
+	Disp                  bool
+	DlFolder              bool
+	DownloadBytes         int64
+	Ext                   string
+	DefaultExt            string // Format of Google Docs files when neither Ext nor the URL gives one
+	Filename              string
+	ID                    string
+	InputtedMimeType      []string
+	Kind                  string
+	Notcreatetopdirectory bool
+	Resumabledownload     string
+	ResumeUntilDone       bool // Download the chunks of Resumabledownload without prompting until the file is complete
+	SearchID              string
+	ShowFileInf           bool
+	Size                  int64
+	SkipError             bool
+	URL                   string
+	WorkDir               string
+	URLForLargeFile       string
+	Concurrency           int
+	ConcurrencyMin        int       // Lower bound of the adaptive concurrency
+	ConcurrencyMax        int       // Upper bound of the adaptive concurrency
+	AdaptiveConcurrency   bool      // Control the concurrency by AIMD instead of a fixed number
+	Connections           int       // Number of connections for one file
+	MinPartSize           int64     // Minimum size of a part of a file downloaded over several connections
+	Force                 bool      // Only warn when the free disk space is not enough
+	Output                io.Writer // Content of a file is written here instead of a local file
+	Extract               bool      // Unpack a downloaded archive
+	ExtractDir            string    // Destination of Extract. A directory next to the archive is used when it is empty.
+	ExtractRemove         bool      // Delete an archive after it has been unpacked
+	NoPreserveTimes       bool      // Keep the download time as the modified time of files and directories
+	Xattr                 bool      // Record the provenance of saved files in their extended attributes
+
+	MD5Checksum    string // md5 of the file on Google Drive when it is known from Drive API
+	SHA256Checksum string // sha256 of the file on Google Drive when it is known from Drive API
+	Verify         bool
+
+	RateLimiter   *RateLimiter // Shared by all downloads of a Downloader
+	FileRateLimit int64        // Bytes per second of each file
+	fileLimiter   *RateLimiter
+
+	SourceURL   string    // URL given by the user, recorded in Result
+	ResourceKey string    // "resourcekey" of the URL given by the user
+	Started     time.Time // Start of the download of the current file
+
+	ModifiedTime time.Time // modifiedTime of the current file when it is known from Drive API
+	CreatedTime  time.Time // createdTime of the current file when it is known from Drive API
+
+	ConflictStrategy string
+	ConflictResolved bool
+	ConflictAction   Action
+	MCPMode          bool // True when operating inside an MCP server
+
+	Endpoints       Endpoints
+	Proxy           string
+	Verbose         bool
+	Retry           int
+	RetryDelay      time.Duration
+	RetryMaxElapsed time.Duration
+	WaitQuota       time.Duration // First interval of polling a file whose download quota is exceeded. 0 disables it.
+
+	StallTimeout          time.Duration // A transfer is aborted when no bytes arrive for this duration
+	ConnectTimeout        time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	MaxConnsPerHost       int // 0 means no limit
+
+	pool      *workerPool     // Shared by all downloads of a Downloader
+	transport *http.Transport // Shared by all downloads of a Downloader
+	Progress  *mpb.Progress
+	Results   *[]Result
+	OnResult  func(Result)
+	mu        *sync.Mutex
+}
+
+// Clone : Deep copy necessary fields to prevent race conditions during concurrent execution.
+func (p *para) Clone() *para {
+	newP := *p
+	return &newP
+}
+
+// defaultMaxIdleConns : Number of idle connections kept for reuse. Folder downloads talk to a few hosts only,
+// so the same number is kept for each host.
+const defaultMaxIdleConns = 100
+
+// newTransport : Create the transport shared by all downloads of a Downloader. It is configured with the proxy settings,
+// connection pooling with keep-alives, HTTP/2 and the timeouts of connecting, the TLS handshake and the response headers.
+// The body is watched by the stall timeout instead of a timeout of the whole request, so a large file is never cut off
+// while it is moving.
+func (p *para) newTransport() *http.Transport {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   p.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConns,
+		MaxConnsPerHost:       p.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   p.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: p.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if p.Proxy != "" {
+		if proxyURL, err := url.Parse(p.Proxy); err == nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		} else {
+			if p.Verbose {
+				p.mu.Lock()
+				fmt.Fprintf(os.Stderr, "[Verbose] Invalid proxy URL %s: %v\n", p.Proxy, err)
+				p.mu.Unlock()
+			}
+		}
+	}
+	return transport
+}
+
+// newCookieClient : Returns a new HTTP client of the shared transport with its own cookie jar.
+// The anonymous download needs the cookies of the virus scan warning page to confirm the download.
+func (p *para) newCookieClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar:       jar,
+		Transport: p.transport,
+	}
+}
+
+// resolveConflict handles file existing conflicts.
+// The returned action is "" when targetPath does not exist, otherwise "skip", "overwrite", "rename" or "abort".
+func (p *para) resolveConflict(targetPath string, remoteTime time.Time) (string, string, error) {
+	if !chkFile(targetPath) {
+		return targetPath, "", nil
+	}
+
+	strategy := p.ConflictStrategy
+
+	if strategy == "prompt" && p.MCPMode {
+		return "", "", fmt.Errorf("File '%s' already exists. Ask the user for the preferred conflict resolution strategy (skip, overwrite, newer, rename) and call this tool again with the explicit 'conflict' parameter.", filepath.Base(targetPath))
+	}
+
+	// Graceful fallback for non-interactive environments outside MCP
+	if strategy == "prompt" && !term.IsTerminal(int(syscall.Stdin)) {
+		strategy = "rename"
+	}
+
+prompt_loop:
+	for {
+		switch strategy {
+		case "skip":
+			return targetPath, "skip", nil
+		case "overwrite":
+			return targetPath, "overwrite", nil
+		case "newer":
+			localInfo, err := os.Stat(targetPath)
+			if err != nil {
+				return targetPath, "overwrite", nil
+			}
+			// The provenance written with '--xattr' identifies an unchanged file even when its time was changed.
+			if unchangedFile(targetPath, p.ID, p.Size, p.MD5Checksum, remoteTime) {
+				return targetPath, "skip", nil
+			}
+			if remoteTime.IsZero() {
+				if !p.Disp {
+					p.mu.Lock()
+					fmt.Fprintf(os.Stderr, "[*] Warning: Cannot determine remote time for '%s'. Falling back to 'rename'.\n", filepath.Base(targetPath))
+					p.mu.Unlock()
+				}
+				strategy = "rename"
+				continue prompt_loop
+			}
+			// The recorded modifiedTime is that of the version on Google Drive which was saved.
+			localTime := localInfo.ModTime()
+			if pr, ok := ReadProvenance(targetPath); ok && pr.ID == p.ID && !pr.ModifiedTime.IsZero() {
+				localTime = pr.ModifiedTime
+			}
+			if remoteTime.After(localTime) {
+				return targetPath, "overwrite", nil
+			}
+			return targetPath, "skip", nil
+		case "rename":
+			ext := filepath.Ext(targetPath)
+			base := targetPath[:len(targetPath)-len(ext)]
+
+			timestamp := time.Now().Format("20060102_150405")
+			newPath := fmt.Sprintf("%s_%s%s", base, timestamp, ext)
+			if !chkFile(newPath) {
+				return newPath, "rename", nil
+			}
+
+			for i := 1; ; i++ {
+				newPath = fmt.Sprintf("%s_%s_%d%s", base, timestamp, i, ext)
+				if !chkFile(newPath) {
+					return newPath, "rename", nil
+				}
+			}
+		case "prompt":
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "\r\033[K[Conflict] File '%s' already exists.\n", filepath.Base(targetPath))
+			if p.DlFolder {
+				fmt.Fprintf(os.Stderr, "Hint: You are downloading a folder. Use '--conflict [skip|overwrite|newer|rename]' to avoid repeated prompts.\n")
+			}
+			fmt.Fprintf(os.Stderr, "Choose action - [s]kip, [o]verwrite, [n]ewer, [r]ename, [a]bort: ")
+
+			var input string
+			var b [1]byte
+			// Raw read to explicitly prevent bufio from consuming the pipe stream ahead of time
+			for {
+				n, err := os.Stdin.Read(b[:])
+				if err != nil || n == 0 {
+					break
+				}
+				if b[0] == '\n' {
+					break
+				}
+				if b[0] != '\r' {
+					input += string(b[0])
+				}
+			}
+			p.mu.Unlock()
+
+			input = strings.TrimSpace(strings.ToLower(input))
+			switch input {
+			case "s", "skip":
+				return targetPath, "skip", nil
+			case "o", "overwrite":
+				return targetPath, "overwrite", nil
+			case "n", "newer":
+				strategy = "newer"
+			case "r", "rename":
+				strategy = "rename"
+			case "a", "abort":
+				return targetPath, "abort", fmt.Errorf("%w for %s", ErrConflictAborted, targetPath)
+			default:
+				p.mu.Lock()
+				fmt.Fprintf(os.Stderr, "Invalid input. Please try again.\n")
+				p.mu.Unlock()
+			}
+		default:
+			return targetPath, "skip", fmt.Errorf("unknown conflict strategy: %s", strategy)
+		}
+	}
+}
+
+// getURLFromHTML : Get the download URL from HTML robustly.
+func (p *para) getURLFromHTML(html *http.Response) error {
+	br := html.Body
+	doc, err := goquery.NewDocumentFromReader(br)
+	if err != nil {
+		return err
+	}
+
+	var urlStr string
+	var b bool
+	var form *goquery.Selection
+
+	// Strategy 1: Conventional id="download-form". Google Drive submits it to "drive.usercontent.google.com/download"
+	// with the hidden fields "id", "export", "confirm", "uuid" and "at".
+	form = doc.Find("form[id='download-form']")
+	if form.Length() > 0 {
+		urlStr, b = form.Attr("action")
+	}
+
+	// Strategy 2: Any <form> tag submitted to the download endpoint of drive.usercontent.google.com
+	// or with an action containing "confirm="
+	if !b {
+		doc.Find("form").EachWithBreak(func(i int, s *goquery.Selection) bool {
+			act, exists := s.Attr("action")
+			if exists && (isUserContentDownload(act) || strings.Contains(act, "confirm=")) {
+				urlStr = act
+				b = true
+				form = s
+				return false
+			}
+			return true
+		})
+	}
+
+	// Strategy 3: Specific <a> tag link
+	if !b {
+		link := doc.Find("a[id='uc-download-link']")
+		if link.Length() > 0 {
+			if href, exists := link.Attr("href"); exists {
+				urlStr = href
+				b = true
+			}
+		}
+	}
+
+	// Strategy 4: Raw HTML regex fallback
+	if !b {
+		rawHTML, _ := doc.Html()
+		re := regexp.MustCompile(`/uc\?export=download(?:&amp;|&)confirm=[\w-]+(?:(?:&amp;|&)\w+=[\w-]+)*`)
+		match := re.FindString(rawHTML)
+		if match != "" {
+			urlStr = strings.ReplaceAll(match, "&amp;", "&")
+			b = true
+			if !strings.HasPrefix(urlStr, "http") {
+				urlStr = strings.TrimSuffix(p.Endpoints.Drive, "/") + urlStr
+			}
+		}
+	}
+
+	if !b {
+		rawHTML, _ := doc.Html()
+		if err := classifyPage(rawHTML); err != nil {
+			return err
+		}
+		if p.Verbose {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] Failed to parse HTML. Raw HTML snippet length: %d\n", len(rawHTML))
+			p.mu.Unlock()
+		}
+		return fmt.Errorf("failed to extract Google Drive large-file warning download URL (%w)", ErrEndpointChanged)
+	}
+
+	if p.Verbose {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[Verbose] Extracted confirmation URL: %s\n", urlStr)
+		p.mu.Unlock()
+	}
+
+	u, err := p.confirmURL(html, urlStr, form)
+	if err != nil {
+		return err
+	}
+	p.URLForLargeFile = u
+	return nil
+}
+
+// confirmURL : URL of the confirmed download. The action is resolved against the URL of the warning page,
+// and the hidden fields of form, e.g. "uuid" and "at" of drive.usercontent.google.com, are set to its query.
+func (p *para) confirmURL(html *http.Response, action string, form *goquery.Selection) (string, error) {
+	base, err := url.Parse(p.Endpoints.Drive)
+	if err != nil {
+		return "", err
+	}
+	if html.Request != nil {
+		base = html.Request.URL
+	}
+	u, err := base.Parse(action)
+	if err != nil {
+		return "", fmt.Errorf("wrong download URL on the warning page (%w): %v", ErrEndpointChanged, err)
+	}
+	q := u.Query()
+	if form != nil && form.Length() > 0 {
+		form.Find("input[type='hidden']").Each(func(i int, s *goquery.Selection) {
+			if name, ok := s.Attr("name"); ok && name != "" {
+				value, _ := s.Attr("value")
+				q.Set(name, value)
+			}
+		})
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// isUserContentDownload : Check whether s is the download endpoint of drive.usercontent.google.com.
+func isUserContentDownload(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Host == userContentHost && u.Path == "/download"
+}
+
+// saveFile : Save retrieved data as a file with progress bar integration.
+func (p *para) saveFile(ctx context.Context, res *http.Response) error {
+	defer res.Body.Close()
+
+	var err error
+	if len(res.Header["Content-Type"]) > 0 {
+		p.ContentType = res.Header["Content-Type"][0]
+	}
+	if err = p.getFilename(res); err != nil {
+		return err
+	}
+	if p.Output != nil {
+		return p.saveStream(ctx, res)
+	}
+
+	targetPath := filepath.Join(p.WorkDir, p.Filename)
+
+	remoteTime := p.remoteTime(res)
+	if p.DownloadBytes == -1 && !p.ConflictResolved {
+		resolvedPath, action, err := p.resolveConflict(targetPath, remoteTime)
+		if err != nil {
+			return err
+		}
+		if action == "skip" {
+			p.Filename = filepath.Base(targetPath)
+			if !p.Disp {
+				p.mu.Lock()
+				fmt.Fprintf(os.Stderr, "[*] Skipped: '%s' already exists.\n", p.Filename)
+				p.mu.Unlock()
+			}
+			p.addSkipped(targetPath)
+			return nil
+		}
+
+		p.Filename = filepath.Base(resolvedPath)
+		targetPath = resolvedPath
+		p.ConflictResolved = true
+		p.ConflictAction = conflictAction(action)
+	}
+
+	if p.Size <= 0 {
+		p.Size = res.ContentLength
+	}
+	// The files of a folder have been checked together before the download.
+	if p.DownloadBytes == -1 && !p.DlFolder {
+		if err := p.checkFreeSpace(filepath.Dir(targetPath), p.remainingBytes(targetPath, p.ID, p.Size, p.MD5Checksum)); err != nil {
+			return &FileError{ID: p.ID, Err: err}
+		}
+	}
+	bar := p.newBar()
+	if p.FileRateLimit > 0 {
+		p.fileLimiter = NewRateLimiter(p.FileRateLimit)
+	}
+
+	// A whole file is written to a .part file which can be resumed. A resumable download with '-r' appends to the file.
+	var sums checksums
+	if p.DownloadBytes == -1 {
+		sums, err = p.savePartFile(ctx, res, targetPath, bar)
+	} else {
+		err = p.appendFile(ctx, res, targetPath, bar)
+	}
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	if bar != nil {
+		if err != nil {
+			bar.Abort(false)
+		} else {
+			bar.SetTotal(-1, true)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := os.Stat(targetPath)
+	if err != nil {
+		return err
+	}
+	var extracted []string
+	if p.DownloadBytes == -1 {
+		md5sum := sums.MD5
+		if md5sum == "" {
+			md5sum = p.MD5Checksum
+		}
+		p.recordProvenance(targetPath, Provenance{ID: p.ID, MD5: md5sum, URL: p.SourceURL, ModifiedTime: remoteTime, MimeType: p.ContentType})
+		p.preserveTimes(targetPath, remoteTime, p.CreatedTime)
+	}
+	if p.Extract && p.DownloadBytes == -1 {
+		if extracted, err = p.extractArchive(targetPath); err != nil {
+			return &FileError{ID: p.ID, Err: err}
+		}
+	}
+
+	p.addResult(Result{
+		Path:         targetPath,
+		Filename:     p.Filename,
+		Type:         p.Kind,
+		MimeType:     p.ContentType,
+		FileSize:     fileInfo.Size(),
+		MD5:          sums.MD5,
+		SHA256:       sums.SHA256,
+		Verification: sums.Verification,
+		Action:       p.ConflictAction,
+		Extracted:    extracted,
+	})
+
+	return nil
+}
+
+// newBar : Create a progress bar of the current file. nil is returned when the progress is not shown.
+func (p *para) newBar() *mpb.Bar {
+	if p.Disp || p.Progress == nil || p.MCPMode {
+		return nil
+	}
+	nameDecor := decor.Name(p.Filename, decor.WCSyncSpaceR)
+	if p.Size > 0 {
+		return p.Progress.AddBar(p.Size,
+			mpb.PrependDecorators(
+				nameDecor,
+				decor.CountersKibiByte("% .2f / % .2f", decor.WCSyncSpaceR),
+			),
+			mpb.AppendDecorators(
+				decor.EwmaETA(decor.ET_STYLE_GO, 90),
+				decor.Name(" ] "),
+				decor.Percentage(),
+			),
+		)
+	}
+	return p.Progress.AddBar(0,
+		mpb.PrependDecorators(
+			nameDecor,
+			decor.CurrentKibiByte("% .2f", decor.WCSyncSpaceR),
+		),
+		mpb.AppendDecorators(
+			decor.OnComplete(decor.Spinner(nil), "Done"),
+		),
+	)
+}
+
+// bodyReader : Limit the bandwidth of r and count the bytes read from r on bar.
+func (p *para) bodyReader(ctx context.Context, r io.Reader, bar *mpb.Bar) io.Reader {
+	r = p.limitReader(ctx, r)
+	if bar == nil {
+		return r
+	}
+	return bar.ProxyReader(r)
+}
+
+// appendFile : Append the content of res to targetPath for the resumable download.
+func (p *para) appendFile(ctx context.Context, res *http.Response, targetPath string, bar *mpb.Bar) error {
+	file, err := os.OpenFile(targetPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, p.bodyReader(ctx, p.watchStall(res.Body), bar))
+	return err
+}
+
+// addSkipped : Record a local file which was kept by the conflict resolution.
+func (p *para) addSkipped(targetPath string) {
+	r := Result{
+		Path:     targetPath,
+		Filename: filepath.Base(targetPath),
+		Type:     p.Kind,
+		Action:   ActionSkipped,
+	}
+	if info, err := os.Stat(targetPath); err == nil {
+		r.FileSize = info.Size()
+	}
+	p.addResult(r)
+}
+
+// conflictAction : Convert an action of resolveConflict to Action.
+func conflictAction(action string) Action {
+	switch action {
+	case "skip":
+		return ActionSkipped
+	case "overwrite":
+		return ActionOverwritten
+	case "rename":
+		return ActionRenamed
+	}
+	return ""
+}
+
+// getFilename : Retrieve filename from header.
+func (p *para) getFilename(s *http.Response) error {
+	if len(s.Header["Content-Disposition"]) > 0 {
+		_, paraMap, err := mime.ParseMediaType(s.Header["Content-Disposition"][0])
+		if err != nil {
+			return err
+		}
+		if p.Filename == "" {
+			p.Filename = paraMap["filename"]
+		}
+	} else {
+		body, _ := io.ReadAll(s.Body)
+		rFilename := regexp.MustCompile(`<span class="uc-name-size"><a[\w\s\S]+?>([\w\s\S]+?)<\/a>`)
+		matches := rFilename.FindAllStringSubmatch(string(body), -1)
+		if len(matches) == 0 {
+			return &FileError{ID: p.ID, Err: errors.New("cannot be downloaded")}
+		}
+		p.Filename = matches[0][1]
+	}
+	return nil
+}
+
+// downloadLargeFile : When a large size of file is downloaded, this method is used.
+func (p *para) downloadLargeFile(ctx context.Context) error {
+	if p.APIKey != "" {
+		dlfile, err := p.getFileInfFromP(ctx)
+		if err != nil {
+			return err
+		}
+		p.Size = dlfile.Size
+		p.MD5Checksum = dlfile.Md5Checksum
+		p.SHA256Checksum = dlfile.Sha256Checksum
+		p.ModifiedTime = driveTime(dlfile.ModifiedTime)
+		p.CreatedTime = driveTime(dlfile.CreatedTime)
+	}
+	res, err := p.fetch(ctx, p.URLForLargeFile)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != 200 && p.Kind != "file" {
+		return &FileError{ID: p.ID, Err: newHTTPError(res)}
+	}
+	// The confirmed download can still be refused with an interstitial page, e.g. when the quota is exceeded.
+	if _, ok := res.Header["Content-Disposition"]; !ok {
+		if err := pageError(res); err != nil {
+			res.Body.Close()
+			return &FileError{ID: p.ID, Err: err}
+		}
+	}
+	return p.saveFile(ctx, res)
+}
+
+// fetch : Fetch data from Google Drive, retrying by the retry policy.
+func (p *para) fetch(ctx context.Context, url string) (*http.Response, error) {
+	return p.fetchWithHeader(ctx, url, nil)
+}
+
+// fetchWithHeader : fetch with additional request headers such as "Range".
+func (p *para) fetchWithHeader(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if keys := p.resourceKeysHeader(); keys != "" {
+		req.Header.Set("X-Goog-Drive-Resource-Keys", keys)
+	}
+	return p.doWithRetry(req, p.Client.Do)
+}
+
+// checkURL : Parse inputted URL.
+func (p *para) checkURL(ctx context.Context, s string) error {
+	t, err := ParseTarget(s)
+	if err != nil {
+		return err
+	}
+	p.ResourceKey = t.ResourceKey
+
+	switch t.Kind {
+	case TargetFolder:
+		p.DlFolder = true
+		p.SearchID = t.ID
+		if p.APIKey == "" {
+			return fmt.Errorf("%w to download files in a folder", ErrAPIKeyRequired)
+		}
+		return p.getFilesFromFolder(ctx)
+	case TargetFile:
+		p.Kind = string(t.Kind)
+		p.ID = t.ID
+		p.URL = p.Endpoints.anyURL() + "&id=" + p.ID + p.resourceKeyQuery("&")
+		if p.APIKey != "" {
+			p.URL = p.Endpoints.filesURL() + "/" + p.ID + "?alt=media&supportsAllDrives=true&key=" + p.APIKey
+			dlfile, err := p.getFileInfFromP(ctx)
+			if err != nil {
+				return err
+			}
+			p.Filename = dlfile.Name
+			p.Size = dlfile.Size
+			p.MD5Checksum = dlfile.Md5Checksum
+			p.SHA256Checksum = dlfile.Sha256Checksum
+			p.ModifiedTime = driveTime(dlfile.ModifiedTime)
+			p.CreatedTime = driveTime(dlfile.CreatedTime)
+		}
+	default:
+		p.Kind = string(t.Kind)
+		p.ID = t.ID
+		// An explicit extension comes first, then the format in the URL, then the default.
+		if p.Ext == "" {
+			p.Ext = t.Format
+		}
+		if p.Ext == "" {
+			p.Ext = p.DefaultExt
+		}
+		if p.Ext == "" {
+			p.Ext = "pdf"
+		} else if p.Ext == "ms" {
+			switch t.Kind {
+			case TargetSpreadsheet:
+				p.Ext = "xlsx"
+			case TargetDocument:
+				p.Ext = "docx"
+			case TargetPresentation:
+				p.Ext = "pptx"
+			}
+		}
+		if t.Kind == TargetPresentation || t.Kind == TargetDrawing {
+			p.URL = p.Endpoints.Docs + p.Kind + "/d/" + p.ID + "/export/" + p.Ext + p.resourceKeyQuery("?")
+		} else {
+			p.URL = p.Endpoints.Docs + p.Kind + "/d/" + p.ID + "/export?format=" + p.Ext + p.resourceKeyQuery("&")
+			// Only the sheet of gid is exported. It matters for the formats of one sheet such as csv.
+			if t.GID != "" {
+				p.URL += "&gid=" + t.GID
+			}
+		}
+	}
+
+	if p.APIKey != "" && p.ShowFileInf {
+		return p.showFileInf(ctx)
+	}
+	return nil
+}
+
+// resourceKeyQuery : Query parameter of the resource key of the current file following sep, or "" without it.
+func (p *para) resourceKeyQuery(sep string) string {
+	if p.ResourceKey == "" {
+		return ""
+	}
+	return sep + "resourcekey=" + url.QueryEscape(p.ResourceKey)
+}
+
+// resourceKeysHeader : Value of the "X-Goog-Drive-Resource-Keys" header of Drive API for the current file or folder,
+// or "" without a resource key.
+func (p *para) resourceKeysHeader() string {
+	if p.ResourceKey == "" {
+		return ""
+	}
+	id := p.ID
+	if p.DlFolder {
+		id = p.SearchID
+	}
+	return id + "/" + p.ResourceKey
+}
+
+// download : Main method of download.
+func (p *para) download(ctx context.Context, url string) error {
+	var err error
+	err = p.checkURL(ctx, url)
+	if err != nil {
+		return err
+	}
+	if p.Output != nil && p.Resumabledownload != "" {
+		return fmt.Errorf("a resumable download with '-r' cannot be written to a stream")
+	}
+	if p.APIKey != "" && p.ShowFileInf {
+		return nil
+	} else if p.APIKey == "" && p.ShowFileInf {
+		return fmt.Errorf("%w for the option '--fileinf'", ErrAPIKeyRequired)
+	} else if p.APIKey != "" && p.DlFolder {
+		return nil
+	}
+
+	// A file download takes a worker of the pool shared with folder downloads and concurrent calls.
+	if err := p.pool.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.pool.release()
+
+	// A resumable download with '-r' requests the chunks from Drive API, or from the anonymous download URL without an API key.
+	if p.Resumabledownload != "" && p.Kind == "file" {
+		p.DownloadBytes, err = getDownloadBytes(p.Resumabledownload)
+		if err != nil {
+			return err
+		}
+		return p.resumableDownload(ctx)
+	}
+
+	p.Client = p.newCookieClient()
+
+	res, err := p.fetch(ctx, p.URL)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == 200 {
+		_, chk := res.Header["Content-Disposition"]
+		if chk {
+			return p.saveFile(ctx, res)
+		}
+		if isSignInPage(res) {
+			res.Body.Close()
+			return &FileError{ID: p.ID, Err: ErrLoginRequired}
+		}
+		if err := p.getURLFromHTML(res); err != nil {
+			return &FileError{ID: p.ID, Err: err}
+		}
+		if len(p.URLForLargeFile) == 0 && p.Kind == "file" {
+			return &FileError{ID: p.ID, Err: ErrNotShared}
+		} else if len(p.URLForLargeFile) == 0 && p.Kind != "file" {
+			return p.saveFile(ctx, res)
+		} else {
+			return p.downloadLargeFile(ctx)
+		}
+	}
+	if p.Kind != "file" && res.StatusCode == http.StatusBadRequest {
+		res.Body.Close()
+		return &FileError{ID: p.ID, Err: fmt.Errorf("%w: cannot be downloaded as [ %s ]", ErrExportUnsupported, p.Ext)}
+	}
+	if err := pageError(res); err != nil {
+		res.Body.Close()
+		return &FileError{ID: p.ID, Err: err}
+	}
+	return &FileError{ID: p.ID, Err: newHTTPError(res)}
+}
+
+// isSignInPage : Check whether a request was redirected to the sign-in page, which means the file is not shared.
+func isSignInPage(res *http.Response) bool {
+	if res.Request == nil {
+		return false
+	}
+	u := res.Request.URL
+	return u.Host == "accounts.google.com" || strings.Contains(u.Path, "ServiceLogin")
+}
+
+// sleepContext : Sleep for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
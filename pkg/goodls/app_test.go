@@ -0,0 +1,114 @@
+package goodls
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestGetURLFromHTML : Parse the fixtures of the pages of Google Drive in testdata/pages. Update them when Google
+// changes the pages, so that the regressions are caught here before users hit them.
+func TestGetURLFromHTML(t *testing.T) {
+	const id = "1aBcDeFgHiJkLmNoPqRsTuVwXyZ012345"
+	tests := []struct {
+		page string
+		from string // URL of the page
+		want string
+		err  error
+	}{
+		{"virusscan_usercontent.html", "https://drive.usercontent.google.com/download?id=" + id + "&export=download",
+			"https://drive.usercontent.google.com/download?at=APZUnTXk3v9Qm0aBcDeFgHiJkLmN%3A1716200000000&confirm=t&export=download&id=" + id + "&uuid=5f6c0b1e-8d2a-4c3b-9e7f-0a1b2c3d4e5f", nil},
+		{"virusscan_form_without_id.html", "https://drive.usercontent.google.com/download?id=" + id + "&export=download",
+			"https://drive.usercontent.google.com/download?confirm=t&export=download&id=" + id + "&uuid=5f6c0b1e-8d2a-4c3b-9e7f-0a1b2c3d4e5f", nil},
+		{"virusscan_legacy.html", "https://drive.google.com/uc?export=download&id=" + id,
+			"https://drive.google.com/uc?confirm=Xy1Z&export=download&id=" + id, nil},
+		{"virusscan_script.html", "https://drive.google.com/uc?export=download&id=" + id,
+			"https://drive.google.com/uc?confirm=Xy1Z&export=download&id=" + id, nil},
+		{"virusscan_no_link.html", "https://drive.usercontent.google.com/download?id=" + id, "", ErrVirusScanTooLarge},
+		{"quota.html", "https://drive.usercontent.google.com/download?id=" + id, "", ErrQuotaExceeded},
+		{"deleted.html", "https://drive.google.com/uc?export=download&id=" + id, "", ErrFileDeleted},
+		{"login.html", "https://accounts.google.com/ServiceLogin", "", ErrLoginRequired},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(filepath.Join("testdata", "pages", tt.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, _ := url.Parse(tt.from)
+		p := &para{mu: &sync.Mutex{}, Endpoints: DefaultEndpoints}
+		err = p.getURLFromHTML(&http.Response{Body: f, Request: &http.Request{URL: from}})
+		f.Close()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.page, err, tt.err)
+		}
+		if p.URLForLargeFile != tt.want {
+			t.Errorf("%s: URL = %s, want %s", tt.page, p.URLForLargeFile, tt.want)
+		}
+	}
+}
+
+// BenchmarkTransport : Fetch small files concurrently from a local TLS server, like a folder download,
+// with the shared transport and with a new transport per file as goodls did before.
+func BenchmarkTransport(b *testing.B) {
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "small content")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	p := &para{mu: &sync.Mutex{}}
+	newTransport := func() *http.Transport {
+		t := p.newTransport()
+		t.TLSClientConfig = tlsConfig.Clone()
+		return t
+	}
+	get := func(b *testing.B, client *http.Client) {
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+	run := func(b *testing.B, client func() (*http.Client, func())) {
+		conns.Store(0)
+		b.SetParallelism(4)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				c, done := client()
+				get(b, c)
+				done()
+			}
+		})
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	}
+
+	b.Run("shared", func(b *testing.B) {
+		t := newTransport()
+		defer t.CloseIdleConnections()
+		shared := &http.Client{Transport: t}
+		run(b, func() (*http.Client, func()) { return shared, func() {} })
+	})
+	b.Run("per-file", func(b *testing.B) {
+		run(b, func() (*http.Client, func()) {
+			t := newTransport()
+			return &http.Client{Transport: t}, t.CloseIdleConnections
+		})
+	})
+}
@@ -0,0 +1,138 @@
+package goodls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttleCooldown : Throttling responses within this interval after a decrease count as one congestion event.
+const throttleCooldown = time.Second
+
+// workerPool : Limit of concurrent file downloads shared by all downloads of a Downloader.
+// In the adaptive mode, the limit is controlled by AIMD: it is halved on a throttling response
+// and grows by one after a full window of successful requests, within [min, max].
+type workerPool struct {
+	mu           sync.Mutex
+	limit        float64
+	min          int
+	max          int
+	adaptive     bool
+	active       int
+	changed      chan struct{}
+	lastDecrease time.Time
+	verbose      bool
+}
+
+// newWorkerPool : Create a pool of n workers. When adaptive is true, n is the initial limit within [lo, hi].
+func newWorkerPool(n, lo, hi int, adaptive bool) *workerPool {
+	if !adaptive {
+		lo, hi = n, n
+	}
+	return &workerPool{
+		limit:    float64(max(lo, min(hi, n))),
+		min:      lo,
+		max:      hi,
+		adaptive: adaptive,
+		changed:  make(chan struct{}),
+	}
+}
+
+// broadcast : Wake up the goroutines waiting in acquire. p.mu must be held.
+func (p *workerPool) broadcast() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// acquire : Wait for a free worker or until ctx is done.
+func (p *workerPool) acquire(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	for {
+		p.mu.Lock()
+		if p.active < int(p.limit) {
+			p.active++
+			p.mu.Unlock()
+			return nil
+		}
+		ch := p.changed
+		p.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release : Return a worker acquired by acquire.
+func (p *workerPool) release() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active--
+	p.broadcast()
+}
+
+// succeeded : Additive increase. A full window of successful requests adds one worker.
+func (p *workerPool) succeeded() {
+	if p == nil || !p.adaptive {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	before := int(p.limit)
+	p.limit = min(float64(p.max), p.limit+1/p.limit)
+	if int(p.limit) > before {
+		p.broadcast()
+	}
+}
+
+// throttled : Multiplicative decrease. The workers in flight finish their requests, and no new worker starts
+// until the number of active workers is below the new limit.
+func (p *workerPool) throttled() {
+	if p == nil || !p.adaptive {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.lastDecrease) < throttleCooldown {
+		return
+	}
+	p.lastDecrease = time.Now()
+	p.limit = max(float64(p.min), p.limit/2)
+	if p.verbose {
+		fmt.Fprintf(os.Stderr, "[Verbose] Throttled by Google Drive. Concurrency is reduced to %d\n", int(p.limit))
+	}
+}
+
+// size : Current limit.
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return int(p.limit)
+}
+
+// isThrottled : Check whether res is a throttling response, i.e. 429 or 403 with the reason "rateLimitExceeded"
+// or "userRateLimitExceeded". The body of a 403 response is restored so that it can be read again.
+func isThrottled(res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		return strings.Contains(strings.ToLower(string(body)), "ratelimitexceeded")
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package goodls
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolAIMD(t *testing.T) {
+	p := newWorkerPool(8, 1, 16, true)
+	p.throttled()
+	p.throttled() // Within the cooldown, this is the same congestion event.
+	if n := p.size(); n != 4 {
+		t.Fatalf("size after throttling = %d, want 4", n)
+	}
+	// About one success per worker adds one worker.
+	for i := 0; i < 5; i++ {
+		p.succeeded()
+	}
+	if n := p.size(); n != 5 {
+		t.Errorf("size after a window of successes = %d, want 5", n)
+	}
+	p.lastDecrease = time.Time{}
+	p.limit = 1
+	p.throttled()
+	if n := p.size(); n != 1 {
+		t.Errorf("size below the lower bound = %d", n)
+	}
+
+	fixed := newWorkerPool(3, 1, 16, false)
+	fixed.throttled()
+	fixed.succeeded()
+	if n := fixed.size(); n != 3 {
+		t.Errorf("size of a fixed pool = %d, want 3", n)
+	}
+}
+
+func TestWorkerPoolAcquire(t *testing.T) {
+	p := newWorkerPool(1, 1, 1, false)
+	if err := p.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("acquire of a full pool = %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- p.acquire(context.Background()) }()
+	p.release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{429, "", true},
+		{403, `{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`, true},
+		{403, `{"error":{"errors":[{"reason":"downloadQuotaExceeded"}]}}`, false},
+		{503, "", false},
+	}
+	for _, tt := range tests {
+		res := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+		if got := isThrottled(res); got != tt.want {
+			t.Errorf("isThrottled(%d %s) = %v", tt.status, tt.body, got)
+		}
+		// The body can still be read by newHTTPError.
+		if b, _ := io.ReadAll(res.Body); string(b) != tt.body {
+			t.Errorf("body = %q, want %q", b, tt.body)
+		}
+	}
+}
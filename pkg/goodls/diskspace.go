@@ -0,0 +1,87 @@
+package goodls
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkFreeSpace : Check that the filesystem of dir has room for need bytes.
+// ErrInsufficientSpace is returned when it does not, or only a warning is shown with '--force'.
+// Nothing is checked when the free space cannot be determined on this platform.
+func (p *para) checkFreeSpace(dir string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+	free, err := freeSpace(existingDir(dir))
+	if err != nil {
+		if p.Verbose {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] Free space of '%s' is unknown: %v\n", dir, err)
+			p.mu.Unlock()
+		}
+		return nil
+	}
+	if need <= free {
+		return nil
+	}
+	err = fmt.Errorf("%w on '%s': %s is needed but %s is available", ErrInsufficientSpace, dir, formatBytes(need), formatBytes(free))
+	if !p.Force {
+		return err
+	}
+	if !p.MCPMode {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[*] Warning: %v. Continuing because of '--force'.\n", err)
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// remainingBytes : Number of bytes still to be written to targetPath for the file id of size bytes.
+// A file kept by '--conflict skip' needs nothing, and the bytes recorded in the journal of
+// an unfinished download are already present.
+func (p *para) remainingBytes(targetPath, id string, size int64, md5sum string) int64 {
+	if size <= 0 {
+		return 0
+	}
+	if p.ConflictStrategy == string(ConflictSkip) && chkFile(targetPath) {
+		return 0
+	}
+	// With '-r', a folder skips the local files which are complete.
+	if info, err := os.Stat(targetPath); err == nil && p.Resumabledownload != "" && p.DlFolder && info.Size() == size {
+		return 0
+	}
+	if j := loadJournal(targetPath+journalSuffix, id, size, md5sum, ""); j != nil {
+		return size - j.done()
+	}
+	return size
+}
+
+// existingDir : dir or its nearest existing parent, because the directories of a download may not exist yet.
+func existingDir(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// formatBytes : Format n bytes with a binary unit, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
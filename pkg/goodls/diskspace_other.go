@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package goodls
+
+import "errors"
+
+// freeSpace : The free space cannot be determined on this platform.
+func freeSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,73 @@
+package goodls
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := freeSpace(dir); err != nil {
+		t.Skipf("free space is unknown: %v", err)
+	}
+	p := &para{Disp: true, mu: &sync.Mutex{}}
+	// The directories of a download may not exist yet.
+	target := filepath.Join(dir, "not", "created")
+	if err := p.checkFreeSpace(target, 1); err != nil {
+		t.Errorf("1 byte: %v", err)
+	}
+	if err := p.checkFreeSpace(target, 1<<62); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("err = %v, want ErrInsufficientSpace", err)
+	}
+	p.Force = true
+	p.MCPMode = true
+	if err := p.checkFreeSpace(target, 1<<62); err != nil {
+		t.Errorf("with force: %v", err)
+	}
+}
+
+func TestRemainingBytes(t *testing.T) {
+	dir := t.TempDir()
+	p := &para{ConflictStrategy: string(ConflictRename)}
+	name := filepath.Join(dir, "file.bin")
+	if n := p.remainingBytes(name, "id", 1000, ""); n != 1000 {
+		t.Errorf("new file: %d", n)
+	}
+
+	j := newJournal(name+journalSuffix, "id", 1000, "", "", splitRanges(1000, 2))
+	j.advance(0, 300)
+	j.advance(1, 100)
+	f, err := os.Create(name + partSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := j.save(f); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.remainingBytes(name, "id", 1000, ""); n != 600 {
+		t.Errorf("partial file: %d, want 600", n)
+	}
+	if n := p.remainingBytes(name, "other", 1000, ""); n != 1000 {
+		t.Errorf("journal of another file: %d", n)
+	}
+
+	if err := os.WriteFile(name, []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p.ConflictStrategy = string(ConflictSkip)
+	if n := p.remainingBytes(name, "id", 1000, ""); n != 0 {
+		t.Errorf("skipped file: %d", n)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
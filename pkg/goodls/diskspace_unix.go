@@ -0,0 +1,14 @@
+//go:build unix
+
+package goodls
+
+import "golang.org/x/sys/unix"
+
+// freeSpace : Bytes available to an unprivileged user on the filesystem of dir.
+func freeSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
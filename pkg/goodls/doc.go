@@ -0,0 +1,28 @@
+/*
+Package goodls (doc.go) :
+This is the library behind the goodls CLI. It downloads shared files and entire folder structures from Google Drive without shelling out to the binary.
+
+# Usage
+
+	d := goodls.New(
+		goodls.WithAPIKey(os.Getenv("GOODLS_APIKEY")),
+		goodls.WithDirectory("./datasets"),
+		goodls.WithConflict(goodls.ConflictSkip),
+		goodls.WithConcurrency(10),
+	)
+	defer d.Close()
+
+	results, err := d.DownloadURL(ctx, "https://drive.google.com/file/d/#####/view?usp=sharing")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, r := range results {
+		fmt.Println(r.Filename, r.FileSize)
+	}
+
+	// Folders can also be downloaded by their ID. An API key is required.
+	results, err = d.DownloadFolder(ctx, "#####")
+
+Each option of New mirrors a flag of the CLI. A Downloader never reads stdin or shows progress bars unless WithProgress(true) is given, and WithHeadless(true) additionally makes the 'prompt' conflict strategy return an error instead of asking.
+*/
+package goodls
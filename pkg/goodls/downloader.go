@@ -0,0 +1,510 @@
+package goodls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+)
+
+// ConflictStrategy : How an already existing local file is handled.
+type ConflictStrategy string
+
+// Conflict strategies. They are the values accepted by the CLI flag '--conflict'.
+const (
+	ConflictPrompt    ConflictStrategy = "prompt"
+	ConflictSkip      ConflictStrategy = "skip"
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	ConflictNewer     ConflictStrategy = "newer"
+	ConflictRename    ConflictStrategy = "rename"
+)
+
+// ParseConflictStrategy : Validate a conflict strategy given as a string.
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch c := ConflictStrategy(strings.ToLower(s)); c {
+	case ConflictPrompt, ConflictSkip, ConflictOverwrite, ConflictNewer, ConflictRename:
+		return c, nil
+	}
+	return "", fmt.Errorf("invalid conflict strategy: %s", s)
+}
+
+// Action : What was done with a file which already existed locally.
+type Action string
+
+// Actions recorded in Result. A file which did not exist locally has no action.
+const (
+	ActionSkipped     Action = "skipped"
+	ActionRenamed     Action = "renamed"
+	ActionOverwritten Action = "overwritten"
+	ActionResumed     Action = "resumed" // The .part file of a file of a folder was continued with '-r'
+)
+
+// Result : Record of one file. Skipped and failed files are recorded too.
+type Result struct {
+	ID       string        `json:"ID"`                 // File ID on Google Drive
+	URL      string        `json:"URL"`                // URL given by the user
+	Path     string        `json:"Path,omitempty"`     // Local path of the saved file
+	Filename string        `json:"Filename,omitempty"` // Base name of Path
+	Type     string        `json:"Type,omitempty"`     // "file", "document", "spreadsheets", "presentation" and so on
+	MimeType string        `json:"MimeType,omitempty"` // Content-Type of the downloaded data
+	FileSize int64         `json:"FileSize"`           // Size of the local file
+	MD5      string        `json:"MD5,omitempty"`      // md5 checksum of the downloaded data
+	SHA256   string        `json:"SHA256,omitempty"`   // sha256 checksum of the downloaded data with WithVerify
+	Duration time.Duration `json:"Duration"`           // Elapsed time in nanoseconds
+	Action   Action        `json:"Action,omitempty"`   // Conflict action taken for an existing local file
+	Error    string        `json:"Error,omitempty"`    // Set when the file could not be downloaded
+
+	Verification Verification `json:"Verification,omitempty"` // Comparison with the checksums on Google Drive
+	Extracted    []string     `json:"Extracted,omitempty"`    // Paths of the files unpacked from the archive with WithExtract
+}
+
+// Option : Functional option for New. Each option mirrors a flag of the goodls CLI.
+type Option func(*Downloader)
+
+// WithAPIKey : API key used for folders, file information and resumable downloads ('--apikey').
+func WithAPIKey(key string) Option {
+	return func(d *Downloader) { d.base.APIKey = strings.TrimSpace(key) }
+}
+
+// WithExtension : Output format of Google Docs files such as "pdf", "xlsx" or "ms" ('--extension').
+// It takes precedence over the format in the URL, e.g. "format=csv" of ".../export?format=csv".
+func WithExtension(ext string) Option {
+	return func(d *Downloader) { d.base.Ext = ext }
+}
+
+// WithDefaultExtension : Output format of Google Docs files when neither WithExtension nor the URL gives one.
+// The files of a folder use it too. Without it, a file is exported as "pdf", and the files of a folder in their
+// default formats such as "docx".
+func WithDefaultExtension(ext string) Option {
+	return func(d *Downloader) { d.base.DefaultExt = ext }
+}
+
+// WithFilename : Save a single file under this name instead of its name on Google Drive ('--filename').
+func WithFilename(name string) Option {
+	return func(d *Downloader) { d.base.Filename = name }
+}
+
+// WithOutput : Write the content of a downloaded file to w instead of a local file, e.g. os.Stdout for piping
+// ('-O -' and 'goodls cat'). The progress bars are written to stderr, and conflict resolution is skipped.
+// Folders and resumable downloads with '-r' cannot be written to w, and concurrent calls must not share w.
+func WithOutput(w io.Writer) Option {
+	return func(d *Downloader) { d.base.Output = w }
+}
+
+// WithExtract : Unpack a downloaded zip, tar, tar.gz, tar.zst or gz file ('--extract'). The files go to a directory
+// named after the archive next to it, or to dir when it is not empty ('--extract-dir'). A gzip file of a single file
+// is unpacked next to it. Entries outside the destination and archives expanding to more than 100 times their size
+// (at least 1 GiB) are refused with ErrUnsafeArchive. Symbolic links in archives are skipped.
+func WithExtract(extract bool, dir string) Option {
+	return func(d *Downloader) {
+		d.base.Extract = extract
+		d.base.ExtractDir = dir
+	}
+}
+
+// WithExtractRemove : Delete an archive after it has been extracted with WithExtract ('--extract-remove').
+func WithExtractRemove(remove bool) Option {
+	return func(d *Downloader) { d.base.ExtractRemove = remove }
+}
+
+// WithPreserveTimes : Set the modified time of the downloaded files and the created directories to modifiedTime
+// on Google Drive (default). On Windows, the creation time is set to createdTime as well. With false, the files
+// keep the time of the download ('--no-preserve-times').
+func WithPreserveTimes(preserve bool) Option {
+	return func(d *Downloader) { d.base.NoPreserveTimes = !preserve }
+}
+
+// WithXattr : Record the provenance of every saved file in its extended attributes user.goodls.id, user.goodls.md5,
+// user.goodls.url, user.goodls.modifiedTime and user.goodls.mimeType ('--xattr'). They are supported on Linux.
+// The 'newer' conflict strategy and resumed folders read them back with ReadProvenance to find unchanged files
+// without hashing them.
+func WithXattr(b bool) Option {
+	return func(d *Downloader) { d.base.Xattr = b }
+}
+
+// WithMimeTypes : Download only files with these mimeTypes from a folder ('--mimetype').
+func WithMimeTypes(mimeTypes ...string) Option {
+	return func(d *Downloader) { d.base.InputtedMimeType = mimeTypes }
+}
+
+// WithConflict : Strategy for files which already exist locally ('--conflict'). The default is ConflictRename.
+func WithConflict(strategy ConflictStrategy) Option {
+	return func(d *Downloader) { d.base.ConflictStrategy = string(strategy) }
+}
+
+// WithResumableDownload : Download only the given size such as "100m" and append it to the local file ('--resumabledownload').
+func WithResumableDownload(size string) Option {
+	return func(d *Downloader) { d.base.Resumabledownload = size }
+}
+
+// WithResumeUntilDone : With WithResumableDownload, keep downloading chunks of the given size without prompting
+// until the file is complete, and verify its md5 at the end ('--resume-until-done', '--yes').
+func WithResumeUntilDone(b bool) Option {
+	return func(d *Downloader) { d.base.ResumeUntilDone = b }
+}
+
+// WithProgress : Show progress bars and status messages on the terminal. The default is false ('--NoProgress').
+func WithProgress(show bool) Option {
+	return func(d *Downloader) { d.base.Disp = !show }
+}
+
+// WithFileInfo : Only print the file information as JSON instead of downloading ('--fileinf').
+func WithFileInfo(show bool) Option {
+	return func(d *Downloader) { d.base.ShowFileInf = show }
+}
+
+// WithDirectory : Directory for saving the downloaded files. The default is the working directory ('--directory').
+func WithDirectory(dir string) Option {
+	return func(d *Downloader) { d.base.WorkDir = dir }
+}
+
+// WithNotCreateTopDirectory : Save the contents of a folder without creating the top folder ('--notcreatetopdirectory').
+func WithNotCreateTopDirectory(b bool) Option {
+	return func(d *Downloader) { d.base.Notcreatetopdirectory = b }
+}
+
+// WithSkipError : Skip the files which cannot be downloaded from a folder ('--skiperror').
+func WithSkipError(b bool) Option {
+	return func(d *Downloader) { d.base.SkipError = b }
+}
+
+// WithConcurrency : Number of concurrent file downloads of the Downloader, shared by the files of folders and
+// concurrent calls. The default is 5 ('--concurrency'). With WithAdaptiveConcurrency, n is the initial number.
+func WithConcurrency(n int) Option {
+	return func(d *Downloader) {
+		if n > 0 {
+			d.base.Concurrency = n
+		}
+	}
+}
+
+// WithAdaptiveConcurrency : Control the number of concurrent file downloads by AIMD within [lo, hi] ('--concurrency auto').
+// It is halved when Google Drive answers with 429 or 403 rateLimitExceeded, and grows by one after
+// a window of successful requests.
+func WithAdaptiveConcurrency(lo, hi int) Option {
+	return func(d *Downloader) {
+		d.base.AdaptiveConcurrency = true
+		d.base.ConcurrencyMin = max(lo, 1)
+		d.base.ConcurrencyMax = max(hi, d.base.ConcurrencyMin)
+	}
+}
+
+// WithConnections : Number of connections for downloading one large file in parallel byte ranges. The default is 4 ('--connections').
+// A file is split only when its size is known and the server honours Range requests.
+func WithConnections(n int) Option {
+	return func(d *Downloader) {
+		if n > 0 {
+			d.base.Connections = n
+		}
+	}
+}
+
+// WithMinPartSize : Minimum size of each byte range of WithConnections. The default is 8 MiB.
+func WithMinPartSize(size int64) Option {
+	return func(d *Downloader) {
+		if size > 0 {
+			d.base.MinPartSize = size
+		}
+	}
+}
+
+// WithVerify : Compare the md5 and sha256 checksums of each file with those reported by Drive API, and download
+// the file again when they do not match ('--verify'). The md5 is compared even without this option when it is known.
+// Drive API reports the checksums only when an API key is given.
+func WithVerify(b bool) Option {
+	return func(d *Downloader) { d.base.Verify = b }
+}
+
+// WithRateLimit : Limit the total bandwidth of all downloads of the Downloader to bytesPerSec ('--limit-rate').
+// The limit is shared by the concurrent downloads of a folder and by concurrent calls of the Downloader.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(d *Downloader) {
+		if bytesPerSec > 0 {
+			d.base.RateLimiter = NewRateLimiter(bytesPerSec)
+		}
+	}
+}
+
+// WithRateLimiter : Share l with other Downloaders, e.g. to limit the bandwidth of a whole service.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(d *Downloader) { d.base.RateLimiter = l }
+}
+
+// WithFileRateLimit : Limit the bandwidth of each file to bytesPerSec ('--limit-rate-file').
+func WithFileRateLimit(bytesPerSec int64) Option {
+	return func(d *Downloader) {
+		if bytesPerSec > 0 {
+			d.base.FileRateLimit = bytesPerSec
+		}
+	}
+}
+
+// WithEndpoints : Use other base URLs instead of the Google services, e.g. a mirror or a local fake Drive server.
+// Empty fields of e keep their current values.
+func WithEndpoints(e Endpoints) Option {
+	return func(d *Downloader) { d.base.Endpoints = d.base.Endpoints.merge(e) }
+}
+
+// WithProxy : HTTP/HTTPS proxy URL ('--proxy').
+func WithProxy(proxy string) Option {
+	return func(d *Downloader) { d.base.Proxy = proxy }
+}
+
+// WithVerbose : Output detailed diagnostic logs to stderr ('--verbose').
+func WithVerbose(b bool) Option {
+	return func(d *Downloader) { d.base.Verbose = b }
+}
+
+// WithRetry : Max retry attempts for network errors, 408, 429, 5xx and the rate limit errors ('--retry').
+// A broken download stream is resumed with a Range request as long as it makes progress.
+func WithRetry(n int) Option {
+	return func(d *Downloader) { d.base.Retry = n }
+}
+
+// WithRetryDelay : Base delay of the exponential backoff. The default is 2 seconds ('--retry-delay').
+func WithRetryDelay(delay time.Duration) Option {
+	return func(d *Downloader) {
+		if delay >= 0 {
+			d.base.RetryDelay = delay
+		}
+	}
+}
+
+// WithRetryMaxElapsed : Stop retrying a request after this time since its first attempt. 0 means no limit.
+// The default is 10 minutes ('--retry-max-time').
+func WithRetryMaxElapsed(elapsed time.Duration) Option {
+	return func(d *Downloader) {
+		if elapsed >= 0 {
+			d.base.RetryMaxElapsed = elapsed
+		}
+	}
+}
+
+// WithWaitQuota : Poll a file whose download quota is exceeded until the quota resets, instead of failing with
+// ErrQuotaExceeded. The polling starts after about interval and backs off exponentially up to 1 hour.
+// 0 disables it ('--wait-quota' polls from 1 minute).
+func WithWaitQuota(interval time.Duration) Option {
+	return func(d *Downloader) {
+		if interval >= 0 {
+			d.base.WaitQuota = interval
+		}
+	}
+}
+
+// WithStallTimeout : Abort a transfer when no bytes arrive for timeout. The transfer is resumed with a Range request
+// when retries are enabled. 0 disables the watchdog. The default is 1 minute ('--stall-timeout').
+func WithStallTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) { d.base.StallTimeout = timeout }
+}
+
+// WithConnectTimeout : Timeout of establishing a connection. 0 means no timeout. The default is 30 seconds ('--connect-timeout').
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) { d.base.ConnectTimeout = timeout }
+}
+
+// WithTLSHandshakeTimeout : Timeout of the TLS handshake. 0 means no timeout. The default is 10 seconds ('--tls-timeout').
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) { d.base.TLSHandshakeTimeout = timeout }
+}
+
+// WithResponseHeaderTimeout : Timeout of waiting for the response headers after the request has been sent.
+// 0 means no timeout. The default is 1 minute ('--response-timeout').
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) { d.base.ResponseHeaderTimeout = timeout }
+}
+
+// WithMaxConnsPerHost : Limit the number of connections to each host, including the connections in use.
+// 0 means no limit, which is the default ('--max-conns-per-host').
+func WithMaxConnsPerHost(n int) Option {
+	return func(d *Downloader) {
+		if n >= 0 {
+			d.base.MaxConnsPerHost = n
+		}
+	}
+}
+
+// WithForce : Only warn instead of failing when the free disk space is less than the size of the download ('--force').
+func WithForce(b bool) Option {
+	return func(d *Downloader) { d.base.Force = b }
+}
+
+// WithHeadless : Never prompt on the terminal and never print to stdout.
+// With ConflictPrompt, an existing file returns an error instead of asking. This is used by the MCP server.
+func WithHeadless(b bool) Option {
+	return func(d *Downloader) { d.base.MCPMode = b }
+}
+
+// WithOnResult : fn is called each time a file has been saved, skipped or has failed. Calls are serialized.
+func WithOnResult(fn func(Result)) Option {
+	return func(d *Downloader) { d.base.OnResult = fn }
+}
+
+// Downloader : Downloader of shared files and folders on Google Drive.
+// A Downloader is safe for concurrent use by multiple goroutines.
+type Downloader struct {
+	base para
+}
+
+// New : Create a Downloader configured by opts.
+func New(opts ...Option) *Downloader {
+	d := &Downloader{
+		base: para{
+			Disp:             true,
+			DownloadBytes:    -1,
+			Concurrency:      5,
+			Connections:      4,
+			MinPartSize:      defaultMinPartSize,
+			ConflictStrategy: string(ConflictRename),
+			Endpoints:        DefaultEndpoints,
+			RetryDelay:       2 * time.Second,
+			RetryMaxElapsed:  defaultRetryMaxElapsed,
+			mu:               &sync.Mutex{},
+
+			StallTimeout:          defaultStallTimeout,
+			ConnectTimeout:        defaultConnectTimeout,
+			TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+			ResponseHeaderTimeout: defaultResponseHeaderTimeout,
+		},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if !d.base.Disp && !d.base.MCPMode {
+		// The progress bars must not be mixed with the content written to stdout.
+		if d.base.Output != nil {
+			d.base.Progress = mpb.New(mpb.WithWidth(60), mpb.WithOutput(os.Stderr))
+		} else {
+			d.base.Progress = mpb.New(mpb.WithWidth(60))
+		}
+	}
+	d.base.transport = d.base.newTransport()
+	d.base.Client = &http.Client{Transport: d.base.transport}
+	d.base.pool = newWorkerPool(d.base.Concurrency, d.base.ConcurrencyMin, d.base.ConcurrencyMax, d.base.AdaptiveConcurrency)
+	d.base.pool.verbose = d.base.Verbose
+	return d
+}
+
+// Close : Wait for the progress bars to be rendered completely and close the idle connections.
+// The Downloader cannot be used after Close.
+func (d *Downloader) Close() {
+	if d.base.Progress != nil {
+		d.base.Progress.Wait()
+	}
+	d.base.transport.CloseIdleConnections()
+}
+
+// With : Create a Downloader which differs from d by opts, e.g. in the directory or the conflict strategy of one request
+// of a service. It shares the connections, the worker pool and the progress bars of d, so the options of the connections
+// such as WithProxy and those of the worker pool such as WithConcurrency have no effect. It needs no Close of its own.
+func (d *Downloader) With(opts ...Option) *Downloader {
+	c := &Downloader{base: *d.base.Clone()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.base.transport = d.base.transport
+	c.base.Client = d.base.Client
+	c.base.pool = d.base.pool
+	c.base.Progress = d.base.Progress
+	return c
+}
+
+// Concurrency : Current number of concurrent file downloads. It changes over time with WithAdaptiveConcurrency.
+func (d *Downloader) Concurrency() int {
+	return d.base.pool.size()
+}
+
+// newPara : Create the parameters for one call from the base parameters.
+func (d *Downloader) newPara() (*para, error) {
+	p := d.base.Clone()
+	if p.WorkDir == "" {
+		wd, err := filepath.Abs(".")
+		if err != nil {
+			return nil, err
+		}
+		p.WorkDir = wd
+	}
+	p.Results = &[]Result{}
+	p.Started = time.Now()
+	return p, nil
+}
+
+// addFailure : Record a file which could not be downloaded.
+func (p *para) addFailure(err error) {
+	r := Result{Type: p.Kind, Error: err.Error()}
+	if errors.Is(err, ErrChecksumMismatch) {
+		r.Verification = VerificationFailed
+	}
+	if p.Filename != "" {
+		r.Path = filepath.Join(p.WorkDir, p.Filename)
+		r.Filename = p.Filename
+	}
+	p.addResult(r)
+}
+
+// addResult : Record a file. The ID, the source URL and the elapsed time are filled from p when they are empty.
+func (p *para) addResult(r Result) {
+	if r.ID == "" {
+		r.ID = p.ID
+	}
+	if r.URL == "" {
+		r.URL = p.SourceURL
+	}
+	if r.Duration == 0 && !p.Started.IsZero() {
+		r.Duration = time.Since(p.Started)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.Results = append(*p.Results, r)
+	if p.OnResult != nil {
+		p.OnResult(r)
+	}
+}
+
+// results : Retrieve the recorded results.
+func (p *para) results() []Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Result(nil), *p.Results...)
+}
+
+// DownloadURL : Download a shared file or, when an API key is given, all files in a shared folder.
+// Cancelling ctx aborts the requests in flight. The '<name>.part' files and their '<name>.part.json' journals are
+// kept, so calling DownloadURL again resumes them from the last written byte. Only files of unknown size, such as
+// exported Google Docs files, cannot be resumed and are removed.
+func (d *Downloader) DownloadURL(ctx context.Context, url string) ([]Result, error) {
+	p, err := d.newPara()
+	if err != nil {
+		return nil, err
+	}
+	p.SourceURL = url
+	p, err = p.downloadWaitingQuota(ctx, url)
+	if err != nil && !p.DlFolder {
+		p.addFailure(err)
+	}
+	return p.results(), err
+}
+
+// DownloadFolder : Download all files in the shared folder of folderID. An API key is required.
+// Cancelling ctx keeps the '.part' files and journals like DownloadURL, so calling DownloadFolder again resumes them.
+func (d *Downloader) DownloadFolder(ctx context.Context, folderID string) ([]Result, error) {
+	if d.base.APIKey == "" {
+		return nil, fmt.Errorf("%w to download files in a folder", ErrAPIKeyRequired)
+	}
+	p, err := d.newPara()
+	if err != nil {
+		return nil, err
+	}
+	p.DlFolder = true
+	p.SearchID = folderID
+	p.SourceURL = p.Endpoints.Drive + "drive/folders/" + folderID
+	err = p.getFilesFromFolder(ctx)
+	return p.results(), err
+}
@@ -0,0 +1,1080 @@
+package goodls_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"goodls/pkg/fakedrive"
+	"goodls/pkg/goodls"
+)
+
+// newFakeDrive : Start a fake Drive server with a small file, a large file and Google Docs files.
+func newFakeDrive(t *testing.T) *fakedrive.Server {
+	t.Helper()
+	srv := fakedrive.New()
+	t.Cleanup(srv.Close)
+	srv.AddFile(fakedrive.File{ID: "small", Name: "small.txt", MimeType: "text/plain", Content: []byte("small content")})
+	srv.AddFile(fakedrive.File{ID: "large", Name: "large.bin", Content: bytes.Repeat([]byte("0123456789"), 20000)})
+	srv.AddFile(fakedrive.File{ID: "doc", Name: "report", MimeType: "application/vnd.google-apps.document"})
+	srv.AddFile(fakedrive.File{ID: "sheet", Name: "table", MimeType: "application/vnd.google-apps.spreadsheet"})
+	srv.AddFile(fakedrive.File{ID: "slide", Name: "deck", MimeType: "application/vnd.google-apps.presentation"})
+	return srv
+}
+
+// newDownloader : Create a Downloader which talks to srv and saves files to a temporary directory.
+func newDownloader(t *testing.T, srv *fakedrive.Server, opts ...goodls.Option) (*goodls.Downloader, string) {
+	t.Helper()
+	dir := t.TempDir()
+	opts = append([]goodls.Option{
+		goodls.WithDirectory(dir),
+		goodls.WithEndpoints(goodls.Endpoints{Drive: srv.DriveURL(), Docs: srv.DocsURL(), API: srv.APIURL()}),
+		goodls.WithRetryDelay(0),
+	}, opts...)
+	d := goodls.New(opts...)
+	t.Cleanup(d.Close)
+	return d, dir
+}
+
+// readContent : Content of a file on the fake Drive.
+func readContent(t *testing.T, srv *fakedrive.Server, id string) []byte {
+	t.Helper()
+	res, err := http.Get(srv.APIURL() + "files/" + id + "?alt=media&key=k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// readFile : Read a downloaded file.
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDownloadURLSmallFile(t *testing.T) {
+	srv := newFakeDrive(t)
+	d, dir := newDownloader(t, srv)
+
+	res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view?usp=sharing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Filename != "small.txt" || res[0].FileSize != 13 || res[0].Type != "file" {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+	if got := readFile(t, filepath.Join(dir, "small.txt")); string(got) != "small content" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestDownloadURLLargeFileConfirm(t *testing.T) {
+	srv := newFakeDrive(t)
+	d, dir := newDownloader(t, srv)
+
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/uc?export=download&id=large"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); len(got) != 200000 {
+		t.Errorf("size = %d, want 200000", len(got))
+	}
+	if srv.Hits("confirm=t") != 1 {
+		t.Errorf("the virus scan warning page was not confirmed")
+	}
+}
+
+func TestDownloadURLGoogleDocsExport(t *testing.T) {
+	srv := newFakeDrive(t)
+	tests := []struct {
+		url, ext, want string
+	}{
+		{"https://docs.google.com/document/d/doc/edit?usp=sharing", "", "report.pdf"},
+		{"https://docs.google.com/spreadsheets/d/sheet/edit", "ms", "table.xlsx"},
+		{"https://docs.google.com/presentation/d/slide/edit", "pptx", "deck.pptx"},
+	}
+	for _, tt := range tests {
+		d, dir := newDownloader(t, srv, goodls.WithExtension(tt.ext))
+		if _, err := d.DownloadURL(context.Background(), tt.url); err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, tt.want)); err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+		}
+	}
+}
+
+func TestDownloadURLWithAPIKey(t *testing.T) {
+	srv := newFakeDrive(t)
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"))
+
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); len(got) != 200000 {
+		t.Errorf("size = %d, want 200000", len(got))
+	}
+	if srv.Hits("alt=media") != 1 {
+		t.Errorf("the file was not downloaded by Drive API")
+	}
+}
+
+func TestDownloadFolder(t *testing.T) {
+	srv := fakedrive.New()
+	t.Cleanup(srv.Close)
+	srv.AddFolder("top", "dataset", "")
+	srv.AddFolder("sub", "images", "top")
+	srv.AddFile(fakedrive.File{ID: "f1", Name: "readme.txt", MimeType: "text/plain", Content: []byte("readme"), Parents: []string{"top"}})
+	srv.AddFile(fakedrive.File{ID: "f2", Name: "a.png", MimeType: "image/png", Content: []byte("png"), Parents: []string{"sub"}})
+	srv.AddFile(fakedrive.File{ID: "f3", Name: "notes", MimeType: "application/vnd.google-apps.document", Parents: []string{"sub"}})
+
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"))
+	res, err := d.DownloadFolder(context.Background(), "top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("got %d results, want 3: %+v", len(res), res)
+	}
+	for _, name := range []string{"dataset/readme.txt", "dataset/images/a.png", "dataset/images/notes.docx"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	d, dir = newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithMimeTypes("image/png"), goodls.WithNotCreateTopDirectory(true))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/drive/folders/top?usp=sharing"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "images", "a.png")); string(got) != "png" {
+		t.Errorf("content = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "readme.txt")); err == nil {
+		t.Error("readme.txt was downloaded in spite of the mimeType filter")
+	}
+}
+
+func TestWith(t *testing.T) {
+	srv := newFakeDrive(t)
+	d, dir := newDownloader(t, srv)
+	other := t.TempDir()
+	if _, err := d.With(goodls.WithDirectory(other)).DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(other, "small.txt")); err != nil {
+		t.Error(err)
+	}
+	// d keeps its own options.
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "small.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRetryOnInjectedFaults(t *testing.T) {
+	srv := newFakeDrive(t)
+	srv.InjectFault(fakedrive.Fault{Match: "id=small", Status: 503, Count: 1})
+
+	d, _ := newDownloader(t, srv)
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err == nil {
+		t.Fatal("expected an error without retries")
+	}
+
+	srv.InjectFault(fakedrive.Fault{Match: "id=small", Status: 429, Count: 2})
+	d, dir := newDownloader(t, srv, goodls.WithRetry(2))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "small.txt")); string(got) != "small content" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestDownloadURLCancelled(t *testing.T) {
+	srv := newFakeDrive(t)
+	d, dir := newDownloader(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.DownloadURL(ctx, "https://drive.google.com/file/d/small/view"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files were left: %v", entries)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	srv := newFakeDrive(t)
+	srv.AddFile(fakedrive.File{ID: "private", Name: "private.txt", Content: []byte("private"), NotShared: true})
+	srv.InjectFault(fakedrive.Fault{Match: "/drive/v3/files/quota", Status: 403, Body: `{"error":{"code":403,"message":"The download quota for this file has been exceeded.","errors":[{"reason":"downloadQuotaExceeded"}]}}`})
+	srv.InjectFault(fakedrive.Fault{Match: "id=popular", Status: 200, Body: quotaPage})
+	srv.InjectFault(fakedrive.Fault{Match: "id=deleted", Status: 404, Body: `<html><body><p>Sorry, the file you have requested does not exist.</p></body></html>`})
+
+	anonymous, _ := newDownloader(t, srv)
+	withKey, _ := newDownloader(t, srv, goodls.WithAPIKey("testkey"))
+	tests := []struct {
+		d    *goodls.Downloader
+		url  string
+		want error
+	}{
+		{anonymous, "https://example.com/file", goodls.ErrInvalidURL},
+		{anonymous, "https://drive.google.com/file/d/private/view", goodls.ErrNotShared},
+		{anonymous, "https://drive.google.com/file/d/missing/view", goodls.ErrNotFound},
+		{anonymous, "https://drive.google.com/drive/folders/top", goodls.ErrAPIKeyRequired},
+		{anonymous, "https://docs.google.com/document/d/doc/edit", goodls.ErrExportUnsupported},
+		{withKey, "https://drive.google.com/file/d/missing/view", goodls.ErrNotFound},
+		{withKey, "https://drive.google.com/file/d/quota/view", goodls.ErrQuotaExceeded},
+		{anonymous, "https://drive.google.com/file/d/private/view", goodls.ErrLoginRequired},
+		{anonymous, "https://drive.google.com/file/d/popular/view", goodls.ErrQuotaExceeded},
+		{anonymous, "https://drive.google.com/file/d/deleted/view", goodls.ErrFileDeleted},
+	}
+	for _, tt := range tests {
+		if tt.want == goodls.ErrExportUnsupported {
+			tt.d = goodls.New(goodls.WithDirectory(t.TempDir()), goodls.WithExtension("exe"),
+				goodls.WithEndpoints(goodls.Endpoints{Drive: srv.DriveURL(), Docs: srv.DocsURL(), API: srv.APIURL()}))
+		}
+		_, err := tt.d.DownloadURL(context.Background(), tt.url)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+
+	_, err := withKey.DownloadURL(context.Background(), "https://drive.google.com/file/d/missing/view")
+	var fileErr *goodls.FileError
+	if !errors.As(err, &fileErr) || fileErr.ID != "missing" {
+		t.Errorf("err = %v, want *FileError of 'missing'", err)
+	}
+}
+
+// quotaPage : Page of Google Drive for a file whose download quota is exceeded.
+const quotaPage = `<html><head><title>Google Drive - Quota exceeded</title></head><body><p>Too many users have viewed or downloaded this file recently. Please try accessing the file again later.</p></body></html>`
+
+func TestWaitQuota(t *testing.T) {
+	srv := newFakeDrive(t)
+	srv.InjectFault(fakedrive.Fault{Match: "id=small", Status: 403, Body: quotaPage, Count: 2})
+
+	d, dir := newDownloader(t, srv, goodls.WithWaitQuota(time.Millisecond))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "small.txt")); string(got) != "small content" {
+		t.Errorf("content = %q", got)
+	}
+	if n := srv.Hits("id=small"); n != 3 {
+		t.Errorf("the file was requested %d times, want 3", n)
+	}
+}
+
+func TestResults(t *testing.T) {
+	srv := newFakeDrive(t)
+	srv.AddFile(fakedrive.File{ID: "quote", Name: `say "hi" \ bye.txt`, MimeType: "text/plain", Content: []byte("hi")})
+	d, dir := newDownloader(t, srv, goodls.WithConflict(goodls.ConflictSkip))
+
+	res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/quote/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := goodls.Result{
+		ID:       "quote",
+		URL:      "https://drive.google.com/file/d/quote/view",
+		Path:     filepath.Join(dir, `say "hi" \ bye.txt`),
+		Filename: `say "hi" \ bye.txt`,
+		Type:     "file",
+		MimeType: "text/plain",
+		FileSize: 2,
+		MD5:      "49f68a5c8493ec2c0bf489821c21fc3b",
+	}
+	got := res[0]
+	got.Duration = 0
+	if len(res) != 1 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("result = %+v, want %+v", res, want)
+	}
+	b, err := json.Marshal(res)
+	if err != nil || !json.Valid(b) {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+
+	// The existing file is skipped and recorded.
+	res, err = d.DownloadURL(context.Background(), "https://drive.google.com/file/d/quote/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Action != goodls.ActionSkipped || res[0].FileSize != 2 {
+		t.Errorf("unexpected results: %+v", res)
+	}
+
+	// The renamed file is recorded with its new path.
+	d, _ = newDownloader(t, srv, goodls.WithDirectory(dir), goodls.WithConflict(goodls.ConflictRename))
+	res, err = d.DownloadURL(context.Background(), "https://drive.google.com/file/d/quote/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Action != goodls.ActionRenamed || res[0].Path == want.Path {
+		t.Errorf("unexpected results: %+v", res)
+	}
+
+	// A failed file is recorded with its error.
+	res, err = d.DownloadURL(context.Background(), "https://drive.google.com/file/d/missing/view")
+	if err == nil || len(res) != 1 || res[0].ID != "missing" || res[0].Error != err.Error() {
+		t.Errorf("unexpected results: %+v (%v)", res, err)
+	}
+}
+
+func TestDownloadInParts(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+	opts := []goodls.Option{goodls.WithConnections(4), goodls.WithMinPartSize(1000)}
+	tests := []struct {
+		name        string
+		apiKey      string
+		ignoreRange bool
+		match       string
+		hits        int
+	}{
+		{"anonymous", "", false, "confirm=t", 4},
+		{"api key", "testkey", false, "alt=media", 4},
+		// The other parts are answered with the whole content, so the file is downloaded again over one connection.
+		{"fallback", "testkey", true, "alt=media", 5},
+	}
+	for _, tt := range tests {
+		srv.IgnoreRange = tt.ignoreRange
+		before := srv.Hits(tt.match)
+		d, dir := newDownloader(t, srv, append(opts, goodls.WithAPIKey(tt.apiKey))...)
+		res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := readFile(t, filepath.Join(dir, "large.bin")); !bytes.Equal(got, want) {
+			t.Errorf("%s: content differs", tt.name)
+		}
+		if res[0].MD5 != fmt.Sprintf("%x", md5.Sum(want)) {
+			t.Errorf("%s: md5 = %s", tt.name, res[0].MD5)
+		}
+		if n := srv.Hits(tt.match) - before; n != tt.hits {
+			t.Errorf("%s: %d requests, want %d", tt.name, n, tt.hits)
+		}
+	}
+}
+
+func TestResumePartFile(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+	tests := []struct {
+		name   string
+		apiKey string
+		match  string
+	}{
+		{"anonymous", "", "confirm=t"},
+		{"api key", "testkey", "alt=media"},
+	}
+	for _, tt := range tests {
+		srv.InjectFault(fakedrive.Fault{Match: tt.match, Partial: 50000, Count: 1})
+		d, dir := newDownloader(t, srv, goodls.WithAPIKey(tt.apiKey), goodls.WithConnections(1))
+		name := filepath.Join(dir, "large.bin")
+		if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err == nil {
+			t.Fatalf("%s: expected an error of the dropped connection", tt.name)
+		}
+		if _, err := os.Stat(name); err == nil {
+			t.Fatalf("%s: an incomplete file was saved", tt.name)
+		}
+		var j struct{ Parts []struct{ Done int64 } }
+		if err := json.Unmarshal(readFile(t, name+".part.json"), &j); err != nil || len(j.Parts) != 1 || j.Parts[0].Done == 0 {
+			t.Fatalf("%s: unexpected journal %+v (%v)", tt.name, j, err)
+		}
+
+		before := len(srv.Ranges(tt.match))
+		if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := readFile(t, name); !bytes.Equal(got, want) {
+			t.Errorf("%s: content differs", tt.name)
+		}
+		ranges := srv.Ranges(tt.match)[before:]
+		if wantRange := fmt.Sprintf("bytes=%d-%d", j.Parts[0].Done, len(want)-1); len(ranges) != 1 || ranges[0] != wantRange {
+			t.Errorf("%s: ranges = %v, want %s", tt.name, ranges, wantRange)
+		}
+		for _, leftover := range []string{name + ".part", name + ".part.json"} {
+			if _, err := os.Stat(leftover); err == nil {
+				t.Errorf("%s: %s was left", tt.name, leftover)
+			}
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	srv := newFakeDrive(t)
+	url := "https://drive.google.com/file/d/small/view"
+
+	// The corrupted file is deleted and downloaded again.
+	srv.InjectFault(fakedrive.Fault{Match: "alt=media", Corrupt: true, Count: 1})
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithVerify(true))
+	res, err := d.DownloadURL(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Verification != goodls.VerificationPassed || res[0].SHA256 == "" {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+	if got := readFile(t, filepath.Join(dir, "small.txt")); string(got) != "small content" {
+		t.Errorf("content = %q", got)
+	}
+
+	// Without '--verify', the mismatch of md5 is an error.
+	srv.InjectFault(fakedrive.Fault{Match: "alt=media", Corrupt: true, Count: 1})
+	d, dir = newDownloader(t, srv, goodls.WithAPIKey("testkey"))
+	res, err = d.DownloadURL(context.Background(), url)
+	if !errors.Is(err, goodls.ErrChecksumMismatch) || len(res) != 1 || res[0].Verification != goodls.VerificationFailed {
+		t.Fatalf("unexpected results: %+v (%v)", res, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files were left: %v", entries)
+	}
+
+	// Google Drive reports no checksum without an API key.
+	d, _ = newDownloader(t, srv, goodls.WithVerify(true))
+	if res, err = d.DownloadURL(context.Background(), url); err != nil || res[0].Verification != goodls.VerificationUnavailable {
+		t.Errorf("unexpected results: %+v (%v)", res, err)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1000", 1000},
+		{"500k", 500 << 10},
+		{"5M", 5 << 20},
+		{"1.5g", 3 << 29},
+		{"2MB", 2 << 20},
+		{"", -1},
+		{"0", -1},
+		{"fast", -1},
+	}
+	for _, tt := range tests {
+		got, err := goodls.ParseRate(tt.in)
+		if tt.want == -1 {
+			if err == nil {
+				t.Errorf("ParseRate(%q) = %d, want an error", tt.in, got)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := fakedrive.New()
+	t.Cleanup(srv.Close)
+	srv.AddFolder("top", "dataset", "")
+	for _, id := range []string{"f1", "f2"} {
+		srv.AddFile(fakedrive.File{ID: id, Name: id + ".bin", Content: make([]byte, 100000), Parents: []string{"top"}})
+	}
+
+	// The limit is shared by the concurrent downloads of the folder.
+	d, _ := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithRateLimit(400000))
+	start := time.Now()
+	if _, err := d.DownloadFolder(context.Background(), "top"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("200000 bytes at 400000 bytes/s took only %v", elapsed)
+	}
+
+	d, _ = newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithFileRateLimit(200000))
+	start = time.Now()
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/f1/view"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("100000 bytes at 200000 bytes/s took only %v", elapsed)
+	}
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	srv := fakedrive.New()
+	t.Cleanup(srv.Close)
+	srv.AddFolder("top", "dataset", "")
+	for _, id := range []string{"f1", "f2", "f3", "f4"} {
+		srv.AddFile(fakedrive.File{ID: id, Name: id + ".txt", Content: []byte(id), Parents: []string{"top"}})
+	}
+	srv.InjectFault(fakedrive.Fault{Match: "alt=media", Status: 403, Count: 2,
+		Body: `{"error":{"code":403,"message":"Rate Limit Exceeded","errors":[{"reason":"rateLimitExceeded"}]}}`})
+
+	d, _ := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithConcurrency(8), goodls.WithAdaptiveConcurrency(1, 8), goodls.WithRetry(3))
+	res, err := d.DownloadFolder(context.Background(), "top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 4 {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+	if n := d.Concurrency(); n >= 8 {
+		t.Errorf("concurrency = %d, want less than 8 after throttling", n)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+
+	// Retry-After of the server is honoured.
+	srv.InjectFault(fakedrive.Fault{Match: "id=small", Status: 503, RetryAfter: "1", Count: 1})
+	d, _ := newDownloader(t, srv, goodls.WithRetry(1))
+	start := time.Now()
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v in spite of Retry-After: 1", elapsed)
+	}
+
+	// A response which is not retryable is not retried.
+	srv.InjectFault(fakedrive.Fault{Match: "id=small", Status: 400, Count: 1})
+	d, _ = newDownloader(t, srv, goodls.WithRetry(3))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err == nil {
+		t.Error("expected an error of 400")
+	}
+
+	// The requests of the Drive API client are retried.
+	srv.InjectFault(fakedrive.Fault{Match: "fields=", Status: 500, Count: 1})
+	d, _ = newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithRetry(1))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken stream is resumed with a Range request instead of failing the file.
+	srv.InjectFault(fakedrive.Fault{Match: "alt=media", Partial: 50000, Count: 1})
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithConnections(1), goodls.WithRetry(1))
+	before := len(srv.Ranges("alt=media"))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); !bytes.Equal(got, want) {
+		t.Error("content differs")
+	}
+	if ranges := srv.Ranges("alt=media")[before:]; len(ranges) != 1 || ranges[0] != fmt.Sprintf("bytes=50000-%d", len(want)-1) {
+		t.Errorf("ranges = %v", ranges)
+	}
+}
+
+func TestStallTimeout(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+
+	// Without retries, a stalled transfer fails instead of hanging.
+	srv.InjectFault(fakedrive.Fault{Match: "alt=media", Partial: 50000, Stall: time.Minute, Count: 1})
+	d, _ := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithConnections(1), goodls.WithStallTimeout(200*time.Millisecond))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); !errors.Is(err, goodls.ErrStalled) {
+		t.Fatalf("err = %v, want ErrStalled", err)
+	}
+
+	// With retries, it is resumed from the last written byte.
+	srv.InjectFault(fakedrive.Fault{Match: "alt=media", Partial: 50000, Stall: time.Minute, Count: 1})
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithConnections(1), goodls.WithStallTimeout(200*time.Millisecond), goodls.WithRetry(1))
+	start := time.Now()
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the stalled transfer took %v", elapsed)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); !bytes.Equal(got, want) {
+		t.Error("content differs")
+	}
+}
+
+func TestResumeUntilDone(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+	srv.InjectFault(fakedrive.Fault{Match: "alt=media", Partial: 20000, Count: 1})
+
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithResumableDownload("50000"), goodls.WithResumeUntilDone(true), goodls.WithRetry(1))
+	res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); !bytes.Equal(got, want) {
+		t.Fatal("content differs")
+	}
+	if len(res) != 1 || res[0].Verification != goodls.VerificationPassed || res[0].FileSize != int64(len(want)) {
+		t.Errorf("unexpected results %+v", res)
+	}
+	// The failed first chunk continues from the bytes written before the connection dropped.
+	ranges := srv.Ranges("alt=media")
+	wantRanges := []string{"bytes=0-49999", "bytes=20000-69999", "bytes=70000-119999", "bytes=120000-169999", "bytes=170000-199999"}
+	if fmt.Sprint(ranges) != fmt.Sprint(wantRanges) {
+		t.Errorf("ranges = %v, want %v", ranges, wantRanges)
+	}
+
+	// A complete file is only verified.
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Ranges("alt=media")); n != len(wantRanges) {
+		t.Errorf("%d ranges were requested for a complete file", n-len(wantRanges))
+	}
+}
+
+func TestResumeWithoutAPIKey(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+
+	d, dir := newDownloader(t, srv, goodls.WithResumableDownload("50000"), goodls.WithResumeUntilDone(true))
+	res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); !bytes.Equal(got, want) {
+		t.Fatal("content differs")
+	}
+	if len(res) != 1 || res[0].FileSize != int64(len(want)) {
+		t.Errorf("unexpected results %+v", res)
+	}
+	ranges := srv.Ranges("confirm=t")
+	wantRanges := []string{"bytes=0-0", "bytes=0-49999", "bytes=50000-99999", "bytes=100000-149999", "bytes=150000-199999"}
+	if fmt.Sprint(ranges) != fmt.Sprint(wantRanges) {
+		t.Errorf("ranges = %v, want %v", ranges, wantRanges)
+	}
+	if n := len(srv.Ranges("alt=media")); n != 0 {
+		t.Errorf("%d requests were sent to Drive API without an API key", n)
+	}
+
+	// A download URL without "Content-Disposition" is saved under the file ID.
+	srv.NoDisposition = true
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large")); !bytes.Equal(got, want) {
+		t.Fatal("content differs without Content-Disposition")
+	}
+	srv.NoDisposition = false
+
+	// A server ignoring Range falls back to downloading the whole file over the partial one.
+	srv.IgnoreRange = true
+	path := filepath.Join(dir, "large.bin")
+	if err := os.Truncate(path, 30000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); !bytes.Equal(got, want) {
+		t.Fatal("content differs after the fallback")
+	}
+}
+
+func TestResumeFolder(t *testing.T) {
+	srv := newFakeDrive(t)
+	content := bytes.Repeat([]byte("abcdefghij"), 1000)
+	srv.AddFolder("top", "dataset", "")
+	for _, id := range []string{"complete", "partial", "corrupted", "new", "changed"} {
+		srv.AddFile(fakedrive.File{ID: id, Name: id + ".bin", Parents: []string{"top"}, Content: content})
+	}
+
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithResumableDownload("1m"), goodls.WithConflict(goodls.ConflictOverwrite))
+	local := filepath.Join(dir, "dataset")
+	if err := os.MkdirAll(local, 0777); err != nil {
+		t.Fatal(err)
+	}
+	changed := bytes.Clone(content)
+	changed[0] = 'X'
+	for name, b := range map[string][]byte{"complete.bin": content, "changed.bin": changed} {
+		if err := os.WriteFile(filepath.Join(local, name), b, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The part of a corrupted file does not match the file on Google Drive, so the md5 fails after resuming.
+	writePart(t, filepath.Join(local, "partial.bin"), "partial", content, 3000)
+	writePart(t, filepath.Join(local, "corrupted.bin"), "corrupted", changed, 3000)
+
+	res, err := d.DownloadFolder(context.Background(), "top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]goodls.Action{}
+	for _, r := range res {
+		actions[r.Filename] = r.Action
+	}
+	want := map[string]goodls.Action{"complete.bin": goodls.ActionSkipped, "partial.bin": goodls.ActionResumed, "corrupted.bin": "", "new.bin": "", "changed.bin": goodls.ActionOverwritten}
+	if fmt.Sprint(actions) != fmt.Sprint(want) {
+		t.Errorf("actions = %v, want %v", actions, want)
+	}
+	for name := range want {
+		if got := readFile(t, filepath.Join(local, name)); !bytes.Equal(got, content) {
+			t.Errorf("content of %s differs", name)
+		}
+	}
+	if n := srv.Hits("files/complete?"); n != 0 {
+		t.Errorf("the complete file was requested %d times", n)
+	}
+	if ranges := srv.Ranges("files/partial?"); fmt.Sprint(ranges) != "[bytes=3000-9999]" {
+		t.Errorf("ranges of the partial file = %v", ranges)
+	}
+
+	// The conflict strategy decides about a changed file.
+	d, dir = newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithResumableDownload("1m"), goodls.WithConflict(goodls.ConflictSkip))
+	local = filepath.Join(dir, "dataset")
+	if err := os.MkdirAll(local, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(local, "changed.bin"), changed, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.DownloadFolder(context.Background(), "top"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(local, "changed.bin")); !bytes.Equal(got, changed) {
+		t.Error("the changed file was not skipped")
+	}
+
+	// An interrupted file appears under its name only when it is complete.
+	srv.AddFolder("top2", "interrupted", "")
+	srv.AddFile(fakedrive.File{ID: "cut", Name: "cut.bin", Parents: []string{"top2"}, Content: content})
+	srv.InjectFault(fakedrive.Fault{Match: "files/cut?", Partial: 4000, Count: 1})
+	d, dir = newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithResumableDownload("1m"), goodls.WithConflict(goodls.ConflictSkip), goodls.WithConnections(1))
+	name := filepath.Join(dir, "interrupted", "cut.bin")
+	if _, err := d.DownloadFolder(context.Background(), "top2"); err == nil {
+		t.Fatal("expected an error of the dropped connection")
+	}
+	if _, err := os.Stat(name); err == nil {
+		t.Fatal("an incomplete file was saved under its name")
+	}
+	res, err = d.DownloadFolder(context.Background(), "top2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Action != goodls.ActionResumed {
+		t.Errorf("unexpected results %+v", res)
+	}
+	if got := readFile(t, name); !bytes.Equal(got, content) {
+		t.Error("content of the interrupted file differs")
+	}
+	if ranges := srv.Ranges("files/cut?"); fmt.Sprint(ranges) != "[bytes=4000-9999]" {
+		t.Errorf("ranges of the interrupted file = %v", ranges)
+	}
+}
+
+// writePart : Write the .part file and the journal of an unfinished download of content, whose first done bytes
+// have been written.
+func writePart(t *testing.T, name, id string, content []byte, done int) {
+	t.Helper()
+	part := make([]byte, len(content))
+	copy(part, content[:done])
+	j := fmt.Sprintf(`{"ID":%q,"Size":%d,"Parts":[{"Start":0,"End":%d,"Done":%d}]}`, id, len(content), len(content)-1, done)
+	if err := os.WriteFile(name+".part", part, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name+".part.json", []byte(j), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeVerify(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+
+	// The sha256 of a resumed file is computed, so the verification passes without downloading it again.
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithVerify(true), goodls.WithResumableDownload("1m"), goodls.WithResumeUntilDone(true))
+	name := filepath.Join(dir, "large.bin")
+	if err := os.WriteFile(name, want[:30000], 0666); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Verification != goodls.VerificationPassed || res[0].SHA256 == "" {
+		t.Errorf("unexpected results %+v", res)
+	}
+	if got := readFile(t, name); !bytes.Equal(got, want) {
+		t.Error("content differs")
+	}
+	if ranges := srv.Ranges("alt=media"); fmt.Sprint(ranges) != fmt.Sprintf("[bytes=30000-%d]", len(want)-1) || srv.Hits("alt=media&key=testkey") != 1 {
+		t.Errorf("ranges = %v in %d requests", ranges, srv.Hits("alt=media&key=testkey"))
+	}
+
+	// The same holds for the files of a folder.
+	srv.AddFolder("top", "dataset", "")
+	srv.AddFile(fakedrive.File{ID: "partial", Name: "partial.bin", Parents: []string{"top"}, Content: want})
+	d, dir = newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithVerify(true), goodls.WithResumableDownload("1m"))
+	local := filepath.Join(dir, "dataset")
+	if err := os.MkdirAll(local, 0777); err != nil {
+		t.Fatal(err)
+	}
+	writePart(t, filepath.Join(local, "partial.bin"), "partial", want, 30000)
+	res, err = d.DownloadFolder(context.Background(), "top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Verification != goodls.VerificationPassed || res[0].Action != goodls.ActionResumed {
+		t.Errorf("unexpected results %+v", res)
+	}
+	if got := readFile(t, filepath.Join(local, "partial.bin")); !bytes.Equal(got, want) {
+		t.Error("content of the folder file differs")
+	}
+	if ranges := srv.Ranges("files/partial?"); fmt.Sprint(ranges) != fmt.Sprintf("[bytes=30000-%d]", len(want)-1) || srv.Hits("files/partial?alt=media") != 1 {
+		t.Errorf("ranges of the folder file = %v in %d requests", ranges, srv.Hits("files/partial?alt=media"))
+	}
+}
+
+func TestUserContent(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+
+	// The warning page of drive.usercontent.google.com needs "uuid" and "at", and a copied URL of it is accepted.
+	d, dir := newDownloader(t, srv)
+	if _, err := d.DownloadURL(context.Background(), "https://drive.usercontent.google.com/download?id=large&export=download&confirm=t&uuid=expired"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); !bytes.Equal(got, want) {
+		t.Fatal("content differs")
+	}
+	if n := srv.Hits("/download?at="); n != 1 {
+		t.Errorf("the confirmed download was requested %d times, want 1", n)
+	}
+
+	// The older warning page on "uc" is still supported.
+	srv.LegacyConfirm = true
+	d, dir = newDownloader(t, srv)
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/uc?id=large&export=download"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "large.bin")); !bytes.Equal(got, want) {
+		t.Fatal("content differs with the older warning page")
+	}
+
+	if _, err := d.DownloadURL(context.Background(), "https://drive.usercontent.google.com/download?export=download"); !errors.Is(err, goodls.ErrInvalidURL) {
+		t.Errorf("err = %v, want ErrInvalidURL", err)
+	}
+}
+
+func TestOutputWriter(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "large")
+	srv.InjectFault(fakedrive.Fault{Match: "confirm=t", Partial: 70000, Count: 1})
+
+	// The large-file confirm flow works, and a dropped connection continues from the bytes already written.
+	var buf bytes.Buffer
+	d, dir := newDownloader(t, srv, goodls.WithOutput(&buf), goodls.WithRetry(1))
+	res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/large/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %d bytes, want %d bytes", buf.Len(), len(want))
+	}
+	if len(res) != 1 || res[0].Path != goodls.StdoutPath || res[0].FileSize != int64(len(want)) {
+		t.Errorf("unexpected results %+v", res)
+	}
+	if ranges := srv.Ranges("confirm=t"); fmt.Sprint(ranges) != "[bytes=70000-199999]" {
+		t.Errorf("ranges = %v", ranges)
+	}
+
+	// Google Docs files are exported to the writer too, and no local file is created.
+	buf.Reset()
+	if _, err := d.DownloadURL(context.Background(), "https://docs.google.com/document/d/doc/edit"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() == 0 {
+		t.Error("nothing was written for the exported file")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files were created: %v", entries)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("dataset/rows.csv")
+	w.Write([]byte("a,b\n1,2\n"))
+	zw.Close()
+	srv := newFakeDrive(t)
+	srv.AddFile(fakedrive.File{ID: "bundle", Name: "bundle.zip", MimeType: "application/zip", Content: buf.Bytes()})
+
+	d, dir := newDownloader(t, srv, goodls.WithExtract(true, ""), goodls.WithExtractRemove(true))
+	res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/bundle/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "bundle", "dataset", "rows.csv")
+	if len(res) != 1 || !reflect.DeepEqual(res[0].Extracted, []string{want}) {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	if got := readFile(t, want); string(got) != "a,b\n1,2\n" {
+		t.Errorf("content = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bundle.zip")); !os.IsNotExist(err) {
+		t.Errorf("the archive was not removed: %v", err)
+	}
+
+	// Other files are not touched.
+	res, err = d.DownloadURL(context.Background(), "https://drive.google.com/file/d/small/view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Extracted != nil {
+		t.Errorf("unexpected results %+v", res)
+	}
+}
+
+// modTime : Modified time of a local file.
+func modTime(t *testing.T, name string) time.Time {
+	t.Helper()
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.ModTime()
+}
+
+func TestPreserveTimes(t *testing.T) {
+	srv := newFakeDrive(t)
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv.AddFile(fakedrive.File{ID: "old", Name: "old.txt", Content: []byte("old content"), ModifiedTime: old})
+	srv.AddFile(fakedrive.File{ID: "top", Name: "dataset", MimeType: fakedrive.FolderMimeType, ModifiedTime: old.Add(time.Hour)})
+	srv.AddFile(fakedrive.File{ID: "sub", Name: "sub", MimeType: fakedrive.FolderMimeType, Parents: []string{"top"}, ModifiedTime: old.Add(2 * time.Hour)})
+	srv.AddFile(fakedrive.File{ID: "inner", Name: "inner.txt", Parents: []string{"sub"}, Content: []byte("inner"), ModifiedTime: old.Add(3 * time.Hour)})
+
+	// The time comes from "Last-Modified" without an API key and from modifiedTime of "files.get" with it.
+	for _, apiKey := range []string{"", "testkey"} {
+		d, dir := newDownloader(t, srv, goodls.WithAPIKey(apiKey), goodls.WithConflict(goodls.ConflictNewer))
+		if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/old/view"); err != nil {
+			t.Fatal(err)
+		}
+		if got := modTime(t, filepath.Join(dir, "old.txt")); !got.Equal(old) {
+			t.Errorf("apiKey %q: mtime = %v, want %v", apiKey, got, old)
+		}
+		// The 'newer' strategy skips the unchanged file on the second run.
+		res, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/old/view")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || res[0].Action != goodls.ActionSkipped {
+			t.Errorf("apiKey %q: unexpected results %+v", apiKey, res)
+		}
+	}
+
+	// The files and the directories of a folder get the times of Google Drive.
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"))
+	if _, err := d.DownloadFolder(context.Background(), "top"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]time.Time{
+		"dataset":               old.Add(time.Hour),
+		"dataset/sub":           old.Add(2 * time.Hour),
+		"dataset/sub/inner.txt": old.Add(3 * time.Hour),
+	} {
+		if got := modTime(t, filepath.Join(dir, name)); !got.Equal(want) {
+			t.Errorf("mtime of %s = %v, want %v", name, got, want)
+		}
+	}
+
+	// A resumable download sets the time when the last chunk is written.
+	d, dir = newDownloader(t, srv, goodls.WithResumableDownload("5"), goodls.WithResumeUntilDone(true))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/old/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := modTime(t, filepath.Join(dir, "old.txt")); !got.Equal(old) {
+		t.Errorf("mtime after resuming = %v, want %v", got, old)
+	}
+
+	// With WithPreserveTimes(false), the file keeps the time of the download.
+	d, dir = newDownloader(t, srv, goodls.WithPreserveTimes(false))
+	if _, err := d.DownloadURL(context.Background(), "https://drive.google.com/file/d/old/view"); err != nil {
+		t.Fatal(err)
+	}
+	if got := modTime(t, filepath.Join(dir, "old.txt")); time.Since(got) > time.Hour {
+		t.Errorf("mtime = %v, want the time of the download", got)
+	}
+}
+
+func TestXattr(t *testing.T) {
+	srv := newFakeDrive(t)
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv.AddFile(fakedrive.File{ID: "csv", Name: "rows.csv", MimeType: "text/csv", Content: []byte("a,b\n"), ModifiedTime: modified})
+	url := "https://drive.google.com/file/d/csv/view"
+
+	d, dir := newDownloader(t, srv, goodls.WithAPIKey("testkey"), goodls.WithXattr(true), goodls.WithPreserveTimes(false), goodls.WithConflict(goodls.ConflictNewer))
+	if _, err := d.DownloadURL(context.Background(), url); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rows.csv")
+	got, ok := goodls.ReadProvenance(path)
+	if !ok {
+		t.Skip("extended attributes are not supported")
+	}
+	want := goodls.Provenance{ID: "csv", MD5: fmt.Sprintf("%x", md5.Sum([]byte("a,b\n"))), URL: url, ModifiedTime: modified, MimeType: "text/csv"}
+	if got != want {
+		t.Errorf("provenance = %+v, want %+v", got, want)
+	}
+
+	// The file keeps the time of the download, but the provenance tells that it is unchanged.
+	res, err := d.DownloadURL(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Action != goodls.ActionSkipped {
+		t.Errorf("unexpected results %+v", res)
+	}
+
+	// A newer version on Google Drive is downloaded although the local file was written later.
+	srv.AddFile(fakedrive.File{ID: "csv", Name: "rows.csv", MimeType: "text/csv", Content: []byte("a,b\n1,2\n"), ModifiedTime: modified.Add(time.Hour)})
+	res, err = d.DownloadURL(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Action != goodls.ActionOverwritten {
+		t.Errorf("unexpected results %+v", res)
+	}
+	if got, _ := goodls.ReadProvenance(path); !got.ModifiedTime.Equal(modified.Add(time.Hour)) {
+		t.Errorf("modifiedTime = %v after the update", got.ModifiedTime)
+	}
+}
+
+func TestURLForms(t *testing.T) {
+	srv := newFakeDrive(t)
+	want := readContent(t, srv, "small")
+	for _, u := range []string{
+		"https://drive.google.com/file/d/small",
+		"https://drive.google.com/open?id=small",
+		"https://drive.google.com/uc?id=small",
+		"https://drive.google.com/u/1/uc?id=small&export=download",
+		"https://docs.google.com/uc?id=small",
+		"https://drive.google.com/file/d/small/view?resourcekey=0-abc",
+		"drive.google.com/file/d/small/view",
+	} {
+		d, dir := newDownloader(t, srv)
+		if _, err := d.DownloadURL(context.Background(), u); err != nil {
+			t.Errorf("%s: %v", u, err)
+			continue
+		}
+		if got := readFile(t, filepath.Join(dir, "small.txt")); !bytes.Equal(got, want) {
+			t.Errorf("%s: content differs", u)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package goodls
+
+import "strings"
+
+// Endpoints : Base URLs of the services goodls talks to.
+// They can be pointed at an in-house mirror or a local fake Drive server. An empty field keeps the default.
+type Endpoints struct {
+	Drive string // Anonymous downloads through "uc?export=download". Default is "https://drive.google.com/".
+	Docs  string // Export of Google Docs files. Default is "https://docs.google.com/".
+	API   string // Drive API v3. Default is "https://www.googleapis.com/drive/v3/".
+}
+
+// userContentHost : Host of the downloads of Google Drive. "uc?export=download" redirects large files to its
+// "download" endpoint, which shows the virus scan warning page.
+const userContentHost = "drive.usercontent.google.com"
+
+// DefaultEndpoints : Endpoints of Google.
+var DefaultEndpoints = Endpoints{
+	Drive: "https://drive.google.com/",
+	Docs:  "https://docs.google.com/",
+	API:   "https://www.googleapis.com/drive/v3/",
+}
+
+// merge : Overwrite the fields of e with the non-empty fields of o. Each URL always ends with "/".
+func (e Endpoints) merge(o Endpoints) Endpoints {
+	set := func(dst *string, src string) {
+		if src = strings.TrimSpace(src); src != "" {
+			*dst = strings.TrimSuffix(src, "/") + "/"
+		}
+	}
+	set(&e.Drive, o.Drive)
+	set(&e.Docs, o.Docs)
+	set(&e.API, o.API)
+	return e
+}
+
+// anyURL : URL for downloading a shared file without authorization.
+func (e Endpoints) anyURL() string {
+	return e.Drive + "uc?export=download"
+}
+
+// filesURL : URL of the files resource of Drive API.
+func (e Endpoints) filesURL() string {
+	return e.API + "files"
+}
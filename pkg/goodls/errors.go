@@ -0,0 +1,129 @@
+package goodls
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Sentinel errors. Check them with errors.Is.
+var (
+	ErrInvalidURL        = errors.New("URL is wrong")
+	ErrNotShared         = errors.New("file is not shared")
+	ErrNotFound          = errors.New("file is not found")
+	ErrQuotaExceeded     = errors.New("download quota is exceeded")
+	ErrAPIKeyRequired    = errors.New("API key is required")
+	ErrExportUnsupported = errors.New("export format is not supported")
+	ErrEndpointChanged   = errors.New("specification of the endpoint might have been changed")
+	ErrConflictAborted   = errors.New("download aborted by user")
+	ErrChecksumMismatch  = errors.New("checksum of the downloaded file does not match")
+	ErrRateLimited       = errors.New("rate limit is exceeded")
+	ErrStalled           = errors.New("no data was received for the stall timeout")
+	ErrInsufficientSpace = errors.New("not enough free disk space")
+	ErrUnsafeArchive     = errors.New("archive is unsafe to extract")
+
+	// Interstitial pages of Google Drive. A deleted file is also ErrNotFound, a file behind the sign-in page is
+	// also ErrNotShared, and a virus scan warning page without the download link is also ErrEndpointChanged.
+	ErrFileDeleted       = fmt.Errorf("file has been deleted (%w)", ErrNotFound)
+	ErrLoginRequired     = fmt.Errorf("login is required (%w)", ErrNotShared)
+	ErrVirusScanTooLarge = fmt.Errorf("file is too large to be scanned for viruses, and no download link was found (%w)", ErrEndpointChanged)
+)
+
+// FileError : Error of a file or a folder on Google Drive.
+type FileError struct {
+	ID  string // File ID or folder ID
+	Err error  // Sentinel error, *HTTPError or any other error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("file ID [ %s ]: %v", e.ID, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError : Unexpected HTTP response from Google Drive.
+// errors.Is reports ErrNotFound for 404, ErrQuotaExceeded for the quota errors and ErrRateLimited for 429 and the rate limit errors of Drive API.
+type HTTPError struct {
+	StatusCode int
+	URL        string // Request URL without the API key
+	Reason     string // Reason of the error of Drive API, e.g. "downloadQuotaExceeded"
+	Message    string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is : Map the response to the sentinel errors.
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrQuotaExceeded:
+		return e.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(e.Reason), "quotaexceeded")
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests ||
+			(e.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(e.Reason), "ratelimitexceeded"))
+	}
+	return false
+}
+
+// newHTTPError : Create an HTTPError from a response. The body is consumed and closed.
+func newHTTPError(res *http.Response) *HTTPError {
+	defer res.Body.Close()
+	e := &HTTPError{StatusCode: res.StatusCode}
+	if res.Request != nil {
+		e.URL = redactKey(res.Request.URL)
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	var apiErr struct {
+		Error *struct {
+			Message string `json:"message"`
+			Errors  []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != nil {
+		e.Message = apiErr.Error.Message
+		if len(apiErr.Error.Errors) > 0 {
+			e.Reason = apiErr.Error.Errors[0].Reason
+		}
+	}
+	return e
+}
+
+// fromAPIError : Convert an error of the Drive API client to *FileError.
+func fromAPIError(id string, err error) error {
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) {
+		return err
+	}
+	e := &HTTPError{StatusCode: gErr.Code, Message: gErr.Message}
+	if len(gErr.Errors) > 0 {
+		e.Reason = gErr.Errors[0].Reason
+	}
+	return &FileError{ID: id, Err: e}
+}
+
+// redactKey : URL without the API key for error messages.
+func redactKey(u *url.URL) string {
+	c := *u
+	q := c.Query()
+	if q.Has("key") {
+		q.Set("key", "REDACTED")
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
@@ -0,0 +1,307 @@
+package goodls
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Limits of an extraction against zip bombs. An archive may expand to maxExtractRatio times its size,
+// but always to minExtractLimit. They are variables so that the tests can lower them.
+var (
+	maxExtractRatio int64 = 100
+	minExtractLimit int64 = 1 << 30
+	maxExtractFiles       = 100000
+)
+
+// archiveKind : Format of an archive.
+type archiveKind int
+
+const (
+	archiveNone archiveKind = iota
+	archiveZip
+	archiveTar
+	archiveTarGzip
+	archiveTarZstd
+	archiveGzip
+)
+
+// archiveSuffixes : Filename suffixes of the archives. A longer suffix comes before its shorter one.
+// Office files such as .docx are zip files too, but they are not extracted.
+var archiveSuffixes = []struct {
+	suffix string
+	kind   archiveKind
+}{
+	{".tar.gz", archiveTarGzip},
+	{".tgz", archiveTarGzip},
+	{".tar.zst", archiveTarZstd},
+	{".tzst", archiveTarZstd},
+	{".tar", archiveTar},
+	{".zip", archiveZip},
+	{".gz", archiveGzip},
+}
+
+// detectArchive : Format of the archive name and the name without the suffix of the format.
+func detectArchive(name string) (archiveKind, string) {
+	lower := strings.ToLower(name)
+	for _, a := range archiveSuffixes {
+		if strings.HasSuffix(lower, a.suffix) && len(name) > len(a.suffix) {
+			return a.kind, name[:len(name)-len(a.suffix)]
+		}
+	}
+	return archiveNone, ""
+}
+
+// extractArchive : Unpack the archive at path with '--extract'. The files go to a directory named after the archive
+// next to it, or to ExtractDir. A gzip file of a single file is unpacked next to it. Files which are not archives are
+// left as they are. An existing file is resolved by the conflict strategy. On an error, the files created so far are
+// removed, and existing files are never removed. The paths of the extracted files are returned.
+func (p *para) extractArchive(path string) ([]string, error) {
+	kind, base := detectArchive(filepath.Base(path))
+	if kind == archiveNone {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	dest := p.ExtractDir
+	if dest == "" {
+		dest = filepath.Dir(path)
+		if kind != archiveGzip {
+			dest = filepath.Join(dest, base)
+		}
+	}
+	if err := os.MkdirAll(dest, 0777); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	x := &extractor{root: root, dest: dest, limit: max(info.Size()*maxExtractRatio, minExtractLimit), p: p}
+
+	if kind == archiveZip {
+		err = x.unzip(path)
+	} else {
+		err = x.unpack(path, kind, base)
+	}
+	if err != nil {
+		for _, f := range x.created {
+			os.Remove(f)
+		}
+		return nil, fmt.Errorf("failed to extract '%s': %w", filepath.Base(path), err)
+	}
+
+	if !p.Disp && !p.MCPMode {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[*] Extracted %d files from '%s' to '%s'.\n", len(x.files), filepath.Base(path), dest)
+		p.mu.Unlock()
+	}
+	if p.ExtractRemove {
+		if err := os.Remove(path); err != nil {
+			return x.files, err
+		}
+	}
+	return x.files, nil
+}
+
+// extractor : Writer of the entries of an archive. All files are created through root, so no entry can be written
+// outside the destination, even through a symbolic link which exists there.
+type extractor struct {
+	root    *os.Root
+	dest    string
+	limit   int64 // Maximum total size of the extracted files
+	written int64
+	files   []string // Extracted files
+	created []string // Extracted files which did not exist before
+	p       *para
+}
+
+// localName : Name of an entry relative to the destination. Absolute names and names escaping with ".." are refused.
+func localName(name string) (string, error) {
+	local := filepath.Clean(filepath.FromSlash(strings.TrimSuffix(name, "/")))
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%w: entry '%s' is outside the destination", ErrUnsafeArchive, name)
+	}
+	return local, nil
+}
+
+// mkdir : Create the directory of an entry.
+func (x *extractor) mkdir(name string) error {
+	local, err := localName(name)
+	if err != nil {
+		return err
+	}
+	return x.root.MkdirAll(local, 0777)
+}
+
+// writeFile : Create the file of an entry from r. The total size of the extracted files is limited by x.limit.
+// An existing file is skipped, overwritten or kept with the entry renamed by the conflict strategy, in which
+// modTime of the entry is compared for "newer".
+func (x *extractor) writeFile(name string, r io.Reader, mode fs.FileMode, modTime time.Time) error {
+	local, err := localName(name)
+	if err != nil {
+		return err
+	}
+	if len(x.files) >= maxExtractFiles {
+		return fmt.Errorf("%w: more than %d files", ErrUnsafeArchive, maxExtractFiles)
+	}
+	if dir := filepath.Dir(local); dir != "." {
+		if err := x.root.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	resolvedPath, action, err := x.p.resolveConflict(filepath.Join(x.dest, local), modTime)
+	if err != nil {
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	switch action {
+	case "skip":
+		x.skip(name, "the existing file")
+		return nil
+	case "overwrite":
+		flag = os.O_WRONLY | os.O_TRUNC
+	case "rename":
+		local = filepath.Join(filepath.Dir(local), filepath.Base(resolvedPath))
+	}
+	f, err := x.root.OpenFile(local, flag, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(x.dest, local)
+	x.files = append(x.files, path)
+	if action != "overwrite" {
+		x.created = append(x.created, path)
+	}
+	n, err := io.Copy(f, io.LimitReader(r, x.limit-x.written+1))
+	x.written += n
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && x.written > x.limit {
+		err = fmt.Errorf("%w: it expands to more than %s", ErrUnsafeArchive, formatBytes(x.limit))
+	}
+	return err
+}
+
+// skip : Report an entry which is not extracted, e.g. a symbolic link.
+func (x *extractor) skip(name, kind string) {
+	if x.p.Disp || x.p.MCPMode {
+		return
+	}
+	x.p.mu.Lock()
+	fmt.Fprintf(os.Stderr, "[*] Skipped %s '%s' in the archive.\n", kind, name)
+	x.p.mu.Unlock()
+}
+
+// unzip : Extract a zip file. The sizes in the central directory are checked before anything is written,
+// and the written bytes are counted as well because the sizes can lie.
+func (x *extractor) unzip(path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	var total uint64
+	for _, f := range zr.File {
+		total += f.UncompressedSize64
+	}
+	if total > uint64(x.limit) {
+		return fmt.Errorf("%w: it expands to more than %s", ErrUnsafeArchive, formatBytes(x.limit))
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(f.Name)
+		case mode&fs.ModeSymlink != 0:
+			x.skip(f.Name, "the symbolic link")
+		case mode.IsRegular():
+			err = x.unzipFile(f)
+		default:
+			x.skip(f.Name, "the special file")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unzipFile : Extract a file of a zip file.
+func (x *extractor) unzipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return x.writeFile(f.Name, rc, f.Mode(), f.Modified)
+}
+
+// unpack : Extract a tar file, which may be compressed with gzip or zstd, or a gzip file of a single file named base.
+func (x *extractor) unpack(path string, kind archiveKind, base string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	switch kind {
+	case archiveGzip, archiveTarGzip:
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case archiveTarZstd:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if kind == archiveGzip {
+		// The name in the gzip header is not trusted.
+		return x.writeFile(base, r, 0666, time.Time{})
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(hdr.Name)
+		case tar.TypeReg:
+			err = x.writeFile(hdr.Name, tr, hdr.FileInfo().Mode(), hdr.ModTime)
+		case tar.TypeSymlink, tar.TypeLink:
+			x.skip(hdr.Name, "the link")
+		case tar.TypeXGlobalHeader:
+		default:
+			x.skip(hdr.Name, "the special file")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package goodls
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveEntry : Entry of a test archive. A link has a target.
+type archiveEntry struct {
+	name, body, link string
+}
+
+// writeTar : Write a tar stream of entries to w.
+func writeTar(t *testing.T, w io.Writer, entries []archiveEntry) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeArchive : Create the archive name in dir from entries. The format is chosen by the suffix.
+func writeArchive(t *testing.T, dir, name string, entries []archiveEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	switch kind, _ := detectArchive(name); kind {
+	case archiveZip:
+		zw := zip.NewWriter(&buf)
+		for _, e := range entries {
+			fh := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+			fh.SetMode(0644)
+			body := e.body
+			if e.link != "" {
+				fh.SetMode(os.ModeSymlink | 0777)
+				body = e.link
+			}
+			w, err := zw.CreateHeader(fh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(body))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case archiveTar:
+		writeTar(t, &buf, entries)
+	case archiveTarGzip:
+		zw := gzip.NewWriter(&buf)
+		writeTar(t, zw, entries)
+		zw.Close()
+	case archiveTarZstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTar(t, zw, entries)
+		zw.Close()
+	case archiveGzip:
+		zw := gzip.NewWriter(&buf)
+		zw.Name = "../header-name"
+		zw.Write([]byte(entries[0].body))
+		zw.Close()
+	default:
+		t.Fatalf("%s is not an archive", name)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDetectArchive(t *testing.T) {
+	tests := []struct {
+		name string
+		kind archiveKind
+		base string
+	}{
+		{"data.zip", archiveZip, "data"},
+		{"Data.TAR.GZ", archiveTarGzip, "Data"},
+		{"data.tgz", archiveTarGzip, "data"},
+		{"data.tar.zst", archiveTarZstd, "data"},
+		{"data.tar", archiveTar, "data"},
+		{"log.txt.gz", archiveGzip, "log.txt"},
+		{"report.docx", archiveNone, ""},
+		{".zip", archiveNone, ""},
+	}
+	for _, tt := range tests {
+		if kind, base := detectArchive(tt.name); kind != tt.kind || base != tt.base {
+			t.Errorf("%s: got (%d, %q), want (%d, %q)", tt.name, kind, base, tt.kind, tt.base)
+		}
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "top/"},
+		{name: "top/a.txt", body: "alpha"},
+		{name: "top/sub/b.txt", body: "beta"},
+		{name: "top/link", link: "/etc/passwd"},
+	}
+	for _, name := range []string{"data.zip", "data.tar", "data.tar.gz", "data.tar.zst"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeArchive(t, dir, name, entries)
+			p := &para{Disp: true, mu: &sync.Mutex{}}
+			files, err := p.extractArchive(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(files)
+			want := []string{filepath.Join(dir, "data", "top", "a.txt"), filepath.Join(dir, "data", "top", "sub", "b.txt")}
+			if strings.Join(files, ",") != strings.Join(want, ",") {
+				t.Errorf("files = %v, want %v", files, want)
+			}
+			if b, _ := os.ReadFile(want[1]); string(b) != "beta" {
+				t.Errorf("content = %q", b)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "data", "top", "link")); !os.IsNotExist(err) {
+				t.Errorf("the symbolic link was extracted: %v", err)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("the archive was removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractGzipAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	path := writeArchive(t, dir, "log.txt.gz", []archiveEntry{{body: "line\n"}})
+	p := &para{Disp: true, ExtractRemove: true, mu: &sync.Mutex{}}
+	files, err := p.extractArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The name in the gzip header is ignored.
+	if len(files) != 1 || files[0] != filepath.Join(dir, "log.txt") {
+		t.Fatalf("files = %v", files)
+	}
+	if b, _ := os.ReadFile(files[0]); string(b) != "line\n" {
+		t.Errorf("content = %q", b)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the archive was not removed: %v", err)
+	}
+
+	// Files which are not archives are left as they are.
+	txt := filepath.Join(dir, "log.txt")
+	if files, err := p.extractArchive(txt); err != nil || files != nil {
+		t.Errorf("got (%v, %v) for a text file", files, err)
+	}
+	if _, err := os.Stat(txt); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtractDir(t *testing.T) {
+	dir, dest := t.TempDir(), t.TempDir()
+	path := writeArchive(t, dir, "data.zip", []archiveEntry{{name: "a.txt", body: "alpha"}})
+	p := &para{Disp: true, ExtractDir: dest, mu: &sync.Mutex{}}
+	files, err := p.extractArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != filepath.Join(dest, "a.txt") {
+		t.Errorf("files = %v", files)
+	}
+}
+
+func TestExtractUnsafe(t *testing.T) {
+	traversal := []archiveEntry{{name: "ok.txt", body: "ok"}, {name: "../evil.txt", body: "evil"}}
+	for _, name := range []string{"data.zip", "data.tar.gz"} {
+		dir := t.TempDir()
+		path := writeArchive(t, dir, name, traversal)
+		p := &para{Disp: true, ExtractRemove: true, mu: &sync.Mutex{}}
+		if _, err := p.extractArchive(path); !errors.Is(err, ErrUnsafeArchive) {
+			t.Errorf("%s: got %v, want ErrUnsafeArchive", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: the entry escaped the destination", name)
+		}
+		// The files extracted before the error are removed, and the archive is kept.
+		if _, err := os.Stat(filepath.Join(dir, "data", "ok.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: the extracted file was left", name)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s: the archive was removed", name)
+		}
+	}
+}
+
+func TestExtractBomb(t *testing.T) {
+	ratio, limit := maxExtractRatio, minExtractLimit
+	t.Cleanup(func() { maxExtractRatio, minExtractLimit = ratio, limit })
+	maxExtractRatio, minExtractLimit = 10, 1000
+
+	// Zeros compress far better than 10 times.
+	bomb := []archiveEntry{{name: "zeros", body: strings.Repeat("\x00", 1<<20)}}
+	for _, name := range []string{"bomb.zip", "bomb.tar.gz", "bomb.tar.zst", "zeros.gz"} {
+		dir := t.TempDir()
+		path := writeArchive(t, dir, name, bomb)
+		p := &para{Disp: true, mu: &sync.Mutex{}}
+		if _, err := p.extractArchive(path); !errors.Is(err, ErrUnsafeArchive) {
+			t.Errorf("%s: got %v, want ErrUnsafeArchive", name, err)
+		}
+	}
+}
+
+func TestExtractExisting(t *testing.T) {
+	entries := []archiveEntry{{name: "keep.txt", body: "new"}, {name: "ok.txt", body: "ok"}}
+	tests := []struct {
+		strategy string
+		keep     string // Content of keep.txt after the extraction
+		files    int
+	}{
+		{"skip", "old", 1},
+		{"overwrite", "new", 2},
+		{"rename", "old", 2},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := writeArchive(t, dir, "data.zip", entries)
+		keep := filepath.Join(dir, "data", "keep.txt")
+		os.MkdirAll(filepath.Dir(keep), 0777)
+		if err := os.WriteFile(keep, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p := &para{Disp: true, ConflictStrategy: tt.strategy, mu: &sync.Mutex{}}
+		files, err := p.extractArchive(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.strategy, err)
+		}
+		if len(files) != tt.files {
+			t.Errorf("%s: files = %v", tt.strategy, files)
+		}
+		if b, _ := os.ReadFile(keep); string(b) != tt.keep {
+			t.Errorf("%s: keep.txt = %q, want %q", tt.strategy, b, tt.keep)
+		}
+	}
+
+	// A failed extraction removes only the files which it created.
+	dir := t.TempDir()
+	path := writeArchive(t, dir, "data.zip", append(entries, archiveEntry{name: "../evil.txt", body: "evil"}))
+	keep := filepath.Join(dir, "data", "keep.txt")
+	os.MkdirAll(filepath.Dir(keep), 0777)
+	if err := os.WriteFile(keep, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &para{Disp: true, ConflictStrategy: "rename", mu: &sync.Mutex{}}
+	if _, err := p.extractArchive(path); !errors.Is(err, ErrUnsafeArchive) {
+		t.Fatalf("got %v, want ErrUnsafeArchive", err)
+	}
+	if b, err := os.ReadFile(keep); err != nil || string(b) != "old" {
+		t.Errorf("the existing file was changed: %q, %v", b, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(keep)); len(entries) != 1 {
+		t.Errorf("files were left: %v", entries)
+	}
+}
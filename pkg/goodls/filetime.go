@@ -0,0 +1,47 @@
+package goodls
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// driveTime : Parse a time of Drive API such as modifiedTime. The zero time is returned when it is empty or invalid.
+func driveTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// remoteTime : Modified time of the current file on Google Drive. The time of Drive API is preferred,
+// and the "Last-Modified" header of res is used without an API key.
+func (p *para) remoteTime(res *http.Response) time.Time {
+	if !p.ModifiedTime.IsZero() {
+		return p.ModifiedTime
+	}
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// preserveTimes : Set the modified time of path, and the creation time on Windows, to the times on Google Drive,
+// so that the 'newer' conflict strategy compares them on the next run. Nothing is done with '--no-preserve-times'
+// or when the times are unknown. A failure, e.g. on a filesystem without times, is only a warning.
+func (p *para) preserveTimes(path string, modified, created time.Time) {
+	if p.NoPreserveTimes || modified.IsZero() {
+		return
+	}
+	err := os.Chtimes(path, time.Time{}, modified)
+	if err == nil && !created.IsZero() {
+		err = setCreatedTime(path, created)
+	}
+	if err != nil && !p.Disp && !p.MCPMode {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[*] Warning: Cannot set the time of '%s': %v\n", path, err)
+		p.mu.Unlock()
+	}
+}
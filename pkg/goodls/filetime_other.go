@@ -0,0 +1,10 @@
+//go:build !windows
+
+package goodls
+
+import "time"
+
+// setCreatedTime : The creation time cannot be set on this platform, so it is left as it is.
+func setCreatedTime(path string, t time.Time) error {
+	return nil
+}
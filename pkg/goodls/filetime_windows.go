@@ -0,0 +1,25 @@
+//go:build windows
+
+package goodls
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// setCreatedTime : Set the creation time of path.
+func setCreatedTime(path string, t time.Time) error {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	// FILE_FLAG_BACKUP_SEMANTICS is needed to open a directory.
+	h, err := windows.CreateFile(name, windows.FILE_WRITE_ATTRIBUTES, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	ft := windows.NsecToFiletime(t.UnixNano())
+	return windows.SetFileTime(h, &ft, nil, nil)
+}
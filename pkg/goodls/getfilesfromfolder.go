@@ -0,0 +1,445 @@
+package goodls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	getfilelist "github.com/tanaikech/go-getfilelist"
+	"golang.org/x/sync/errgroup"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi/transport"
+	"google.golang.org/api/option"
+)
+
+// folderFileFields : Fields of the files in a folder. The checksums are added to the default fields of go-getfilelist.
+const folderFileFields = "files(createdTime,description,id,md5Checksum,mimeType,modifiedTime,name,owners,parents,permissions,sha256Checksum,shared,size,webContentLink,webViewLink),nextPageToken"
+
+// mime2ext : Convert mimeType to extension directly from map (O(1)).
+func mime2ext(mime string) string {
+	return mimeVsEx[mime]
+}
+
+// downloadFileByAPIKey : Download file using API key.
+func (p *para) downloadFileByAPIKey(ctx context.Context, file *drive.File) error {
+	u, err := url.Parse(p.Endpoints.filesURL())
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, file.Id)
+	q := u.Query()
+	q.Set("key", p.APIKey)
+	if strings.Contains(file.MimeType, "application/vnd.google-apps") {
+		u.Path = path.Join(u.Path, "export")
+		q.Set("mimeType", file.WebViewLink)
+	} else {
+		q.Set("alt", "media")
+		q.Set("supportsAllDrives", "true") // Support Shared Drives
+	}
+	u.RawQuery = q.Encode()
+
+	p.WorkDir = file.WebContentLink
+	p.Filename = file.Name
+
+	// The journal of an interrupted download is continued from its first missing byte.
+	header := http.Header{}
+	if j := loadJournal(filepath.Join(p.WorkDir, p.Filename)+journalSuffix, file.Id, p.Size, p.MD5Checksum, ""); j != nil && p.Size > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", j.next(), p.Size-1))
+	}
+	res, err := p.fetchWithHeader(ctx, u.String(), header)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		httpErr := newHTTPError(res)
+		if p.SkipError {
+			if !p.MCPMode {
+				fmt.Fprintf(os.Stderr, "!! Downloading '%s' (fileId: %s) was skipped by an error. Status code is %d.\n", file.Name, file.Id, res.StatusCode)
+			}
+			p.addFailure(&FileError{ID: file.Id, Err: httpErr})
+			return nil
+		}
+		return &FileError{ID: file.Id, Err: httpErr}
+	}
+	return p.saveFile(ctx, res)
+}
+
+// makeFileByCondition : Make file by condition.
+func (p *para) makeFileByCondition(ctx context.Context, file *drive.File) error {
+	targetPath := filepath.Join(file.WebContentLink, file.Name)
+	// Google Docs files are exported, so they have no size to resume from.
+	if p.Resumabledownload != "" && !strings.Contains(file.MimeType, "application/vnd.google-apps") {
+		return p.resumeFolderFile(ctx, file, targetPath)
+	}
+	return p.downloadResolvingConflict(ctx, file, targetPath)
+}
+
+// downloadResolvingConflict : Download a file of a folder to targetPath after resolving the conflict with an existing
+// local file by the conflict strategy.
+func (p *para) downloadResolvingConflict(ctx context.Context, file *drive.File, targetPath string) error {
+	resolvedPath, action, err := p.resolveConflict(targetPath, p.ModifiedTime)
+	if err != nil {
+		return err
+	}
+
+	if action == "skip" {
+		if !p.Disp && !p.MCPMode {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[*] Skipped: '%s' already exists.\n", filepath.Base(targetPath))
+			p.mu.Unlock()
+		}
+		p.addSkipped(targetPath)
+		return nil
+	}
+
+	file.Name = filepath.Base(resolvedPath)
+	file.WebContentLink = filepath.Dir(resolvedPath)
+	p.ConflictResolved = true
+	p.ConflictAction = conflictAction(action)
+
+	return p.downloadFileByAPIKey(ctx, file)
+}
+
+// resumeFolderFile : Download a file of a folder with '-r'. A complete local file (same size and md5) is skipped.
+// A missing file is downloaded to its .part file, which continues from the journal of an interrupted run with Range
+// requests, so the file appears under its name only after it has been verified. A continued file whose md5 does not
+// match is downloaded again in full. A local file of another size or md5 was changed on Google Drive, so the conflict
+// strategy decides whether it is overwritten, renamed or skipped.
+func (p *para) resumeFolderFile(ctx context.Context, file *drive.File, targetPath string) error {
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		p.ConflictResolved = true
+		if loadJournal(targetPath+journalSuffix, file.Id, file.Size, file.Md5Checksum, "") != nil {
+			p.ConflictAction = ActionResumed
+		}
+		err := p.downloadFileByAPIKey(ctx, file)
+		// With '--verify', savePartFile has already downloaded it again.
+		if p.ConflictAction != ActionResumed || p.Verify || !errors.Is(err, ErrChecksumMismatch) {
+			return err
+		}
+		// The part file did not belong to the current file on Google Drive. It has been removed with its journal.
+		if !p.MCPMode {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[*] '%s' was corrupted after resuming: %v. Downloading it again.\n", file.Name, err)
+			p.mu.Unlock()
+		}
+		p.ConflictAction = ""
+		return p.downloadFileByAPIKey(ctx, file)
+	}
+	if info.Size() == file.Size {
+		// The provenance written with '--xattr' saves hashing the file.
+		unchanged := unchangedFile(targetPath, file.Id, file.Size, file.Md5Checksum, p.ModifiedTime)
+		if !unchanged && file.Md5Checksum != "" {
+			sums, err := fileChecksums(targetPath, false)
+			if err != nil {
+				return err
+			}
+			unchanged = sums.MD5 == file.Md5Checksum
+		}
+		if unchanged || file.Md5Checksum == "" {
+			if !p.Disp && !p.MCPMode {
+				p.mu.Lock()
+				fmt.Fprintf(os.Stderr, "[*] Skipped: '%s' is complete.\n", file.Name)
+				p.mu.Unlock()
+			}
+			p.addSkipped(targetPath)
+			return nil
+		}
+	}
+	return p.downloadResolvingConflict(ctx, file, targetPath)
+}
+
+// makeDir : Make a directory by checking duplication.
+func (p *para) makeDir(folder string) error {
+	if err := os.MkdirAll(folder, 0777); err != nil {
+		return err
+	}
+	return nil
+}
+
+// chkFile : Check the existence of file and directory in local PC.
+func chkFile(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// makeDirByCondition : Make directory by condition.
+func (p *para) makeDirByCondition(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return fmt.Errorf("cannot create directory '%s', a file with that name already exists", dir)
+	}
+	return p.makeDir(dir)
+}
+
+// initDownload : Download files concurrently by Drive API using API key.
+func (p *para) initDownload(ctx context.Context, srv *drive.Service, fileList *getfilelist.FileListDl) error {
+	if !p.Disp && !p.MCPMode {
+		fmt.Fprintf(os.Stderr, "Download files from a folder '%s'.\n", fileList.SearchedFolder.Name)
+		fmt.Fprintf(os.Stderr, "There are %d files and %d folders in the folder.\n", fileList.TotalNumberOfFiles, fileList.TotalNumberOfFolders-1)
+		fmt.Fprintf(os.Stderr, "Starting download.\n")
+	}
+
+	idToName := map[string]interface{}{}
+	for i, e := range fileList.FolderTree.Folders {
+		idToName[e] = fileList.FolderTree.Names[i]
+	}
+
+	type downloadJob struct {
+		file *drive.File
+		path string
+	}
+	var jobs []downloadJob
+	dirs := map[string]string{} // Folder ID of each local directory
+
+	// Create directories sequentially to prevent race conditions.
+	for _, e := range fileList.FileList {
+		targetPath := p.WorkDir
+		if p.Notcreatetopdirectory {
+			if len(e.FolderTree) > 0 {
+				e.FolderTree = append(e.FolderTree[:0], e.FolderTree[1:]...)
+			}
+		}
+		for _, dir := range e.FolderTree {
+			targetPath = filepath.Join(targetPath, idToName[dir].(string))
+			dirs[targetPath] = dir
+		}
+		if targetPath != p.WorkDir {
+			if err := p.makeDirByCondition(targetPath); err != nil {
+				return err
+			}
+		}
+
+		for _, file := range e.Files {
+			if file.MimeType != "application/vnd.google-apps.script" {
+				jobs = append(jobs, downloadJob{file: file, path: targetPath})
+			} else {
+				if !p.Disp && !p.MCPMode {
+					fmt.Fprintf(os.Stderr, "'%s' is a project file. Project file cannot be downloaded using API key.\n", file.Name)
+				}
+			}
+		}
+	}
+
+	var need int64
+	for _, job := range jobs {
+		need += p.remainingBytes(filepath.Join(job.path, job.file.Name), job.file.Id, job.file.Size, job.file.Md5Checksum)
+	}
+	if err := p.checkFreeSpace(p.WorkDir, need); err != nil {
+		return &FileError{ID: p.SearchID, Err: err}
+	}
+
+	// The worker pool limits the concurrency across folders and concurrent calls, and shrinks when throttled.
+	// The first error or a cancellation stops the pending workers.
+	eg, gctx := errgroup.WithContext(ctx)
+
+	for _, job := range jobs {
+		job := job
+		eg.Go(func() error {
+			if err := p.pool.acquire(gctx); err != nil {
+				return err
+			}
+			defer p.pool.release()
+
+			workerP := p.Clone()
+			job.file.WebContentLink = job.path
+			workerP.ID = job.file.Id
+			workerP.Size = job.file.Size
+			workerP.MD5Checksum = job.file.Md5Checksum
+			workerP.SHA256Checksum = job.file.Sha256Checksum
+			workerP.ModifiedTime = driveTime(job.file.ModifiedTime)
+			workerP.CreatedTime = driveTime(job.file.CreatedTime)
+			workerP.Started = time.Now()
+			if err := workerP.makeFileByCondition(gctx, job.file); err != nil {
+				workerP.WorkDir = job.path
+				workerP.Filename = job.file.Name
+				workerP.addFailure(err)
+				return err
+			}
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	// The times are set after all files are written because a new file changes the time of its directory.
+	p.preserveDirTimes(ctx, srv, dirs, fileList.SearchedFolder)
+	return nil
+}
+
+// preserveDirTimes : Set the times of the local directories to those of their folders on Google Drive.
+// The times of the subfolders are not in the file list, so they are retrieved with "files.get".
+// A folder whose times cannot be retrieved keeps the time of the download.
+func (p *para) preserveDirTimes(ctx context.Context, srv *drive.Service, dirs map[string]string, top *drive.File) {
+	if p.NoPreserveTimes {
+		return
+	}
+	for dir, id := range dirs {
+		folder := top
+		if top == nil || id != top.Id {
+			f, err := srv.Files.Get(id).Fields("createdTime,modifiedTime").SupportsAllDrives(true).Context(ctx).Do()
+			if err != nil {
+				continue
+			}
+			folder = f
+		}
+		p.preserveTimes(dir, driveTime(folder.ModifiedTime), driveTime(folder.CreatedTime))
+	}
+}
+
+// defFormat : Default download format directly from map.
+func defFormat(mime string) string {
+	return defaultformat[mime]
+}
+
+// extToMime : Convert from extension to mimeType of the file on Local directly from map.
+func extToMime(ext string) string {
+	return extVsmime[strings.Replace(strings.ToLower(ext), ".", "", 1)]
+}
+
+// dupChkFoldersFiles : Check duplication of folder names and filenames.
+func (p *para) dupChkFoldersFiles(fileList *getfilelist.FileListDl) {
+	dupChk1 := map[string]bool{}
+	cnt1 := 2
+	for i, folderName := range fileList.FolderTree.Names {
+		if !dupChk1[folderName] {
+			dupChk1[folderName] = true
+		} else {
+			fileList.FolderTree.Names[i] = folderName + "_" + strconv.Itoa(cnt1)
+		}
+	}
+	extt := strings.ToLower(p.Ext)
+	if extt == "" {
+		extt = strings.ToLower(p.DefaultExt)
+	}
+	for i, list := range fileList.FileList {
+		if len(list.Files) > 0 {
+			dupChk2 := map[string]bool{}
+			cnt2 := 2
+			for j, file := range list.Files {
+				if !dupChk2[file.Name] {
+					dupChk2[file.Name] = true
+				} else {
+					ext := filepath.Ext(file.Name)
+					if ext != "" {
+						fileList.FileList[i].Files[j].Name = file.Name[0:len(file.Name)-len(ext)] + "_" + strconv.Itoa(cnt2) + ext
+					} else {
+						fileList.FileList[i].Files[j].Name = file.Name + "_" + strconv.Itoa(cnt2)
+					}
+					cnt2++
+				}
+				mime := defFormat(file.MimeType)
+				if extt != "" {
+					if mime != "" {
+						cmime := func() string {
+							if (extt == "txt" || extt == "text") && file.MimeType == "application/vnd.google-apps.spreadsheet" {
+								return extToMime("csv")
+							} else if extt == "zip" && file.MimeType == "application/vnd.google-apps.presentation" {
+								return extToMime("pptx")
+							}
+							return extToMime(extt)
+						}()
+						if cmime != "" {
+							fileList.FileList[i].Files[j].WebViewLink = cmime
+						} else {
+							fileList.FileList[i].Files[j].WebViewLink = mime
+						}
+					}
+				} else {
+					fileList.FileList[i].Files[j].WebViewLink = mime
+				}
+				if file.MimeType != "application/vnd.google-apps.script" {
+					ext := filepath.Ext(file.Name)
+					if ext == "" {
+						fileList.FileList[i].Files[j].Name += mime2ext(fileList.FileList[i].Files[j].WebViewLink)
+					}
+				}
+			}
+		}
+	}
+}
+
+// ctxTransport : Bind every request to a context. go-getfilelist does not accept a context by itself.
+type ctxTransport struct {
+	ctx          context.Context
+	base         http.RoundTripper
+	resourceKeys string // "X-Goog-Drive-Resource-Keys" of the link of the file or the folder
+}
+
+// RoundTrip : Implement http.RoundTripper.
+func (t *ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.resourceKeys == "" {
+		return t.base.RoundTrip(req.WithContext(t.ctx))
+	}
+	req = req.Clone(t.ctx)
+	req.Header.Set("X-Goog-Drive-Resource-Keys", t.resourceKeys)
+	return t.base.RoundTrip(req)
+}
+
+// newDriveService : Create a Drive API client which uses the API key, the proxy settings, the API endpoint and ctx.
+// Its requests are retried by the retry policy.
+func (p *para) newDriveService(ctx context.Context) (*drive.Service, error) {
+	client := &http.Client{
+		Transport: &ctxTransport{
+			ctx:          ctx,
+			resourceKeys: p.resourceKeysHeader(),
+			base: &retryTransport{
+				p: p,
+				base: &transport.APIKey{
+					Key:       p.APIKey,
+					Transport: p.transport,
+				},
+			},
+		},
+	}
+	return drive.NewService(ctx, option.WithHTTPClient(client), option.WithEndpoint(p.Endpoints.API))
+}
+
+// getFilesFromFolder: This method is the main method for downloading all files in a shared folder.
+func (p *para) getFilesFromFolder(ctx context.Context) error {
+	if p.Output != nil {
+		return fmt.Errorf("files in a folder cannot be written to one stream")
+	}
+	srv, err := p.newDriveService(ctx)
+	if err != nil {
+		return err
+	}
+	fileList, err := func() (*getfilelist.FileListDl, error) {
+		// go-getfilelist uses SupportsAllDrives internally, covering Shared Drives
+		if len(p.InputtedMimeType) > 0 {
+			return getfilelist.Folder(p.SearchID).Fields(folderFileFields).MimeType(p.InputtedMimeType).Do(srv)
+		}
+		return getfilelist.Folder(p.SearchID).Fields(folderFileFields).Do(srv)
+	}()
+	if err != nil {
+		return fromAPIError(p.SearchID, err)
+	}
+	if p.ShowFileInf {
+		r, err := json.Marshal(fileList)
+		if err != nil {
+			return err
+		}
+		if !p.MCPMode {
+			fmt.Printf("%s\n", r)
+		}
+		return nil
+	}
+	p.dupChkFoldersFiles(fileList)
+	if err := p.initDownload(ctx, srv, fileList); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package goodls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxQuotaPoll : Upper bound of the interval of polling a file whose download quota is exceeded.
+const maxQuotaPoll = time.Hour
+
+// interstitialPages : Phrases of the pages which Google Drive shows instead of a file, and the errors for them.
+// The phrases are compared with the lower-cased HTML. The first match wins.
+var interstitialPages = []struct {
+	phrases []string
+	err     error
+}{
+	{[]string{"too many users have viewed or downloaded this file recently", "download quota for this file has been exceeded", "download quota exceeded"}, ErrQuotaExceeded},
+	{[]string{"in the owner&#39;s trash", "in the owner's trash", "has been deleted", "the file you have requested does not exist"}, ErrFileDeleted},
+	{[]string{"accounts.google.com/servicelogin", "sign in to continue to google drive", "you need access", "you need permission"}, ErrLoginRequired},
+	{[]string{"too large for google to scan for viruses", "can&#39;t scan this file for viruses", "can't scan this file for viruses"}, ErrVirusScanTooLarge},
+}
+
+// classifyPage : Error of an interstitial page of Google Drive. nil is returned for other pages.
+func classifyPage(html string) error {
+	html = strings.ToLower(html)
+	for _, page := range interstitialPages {
+		for _, phrase := range page.phrases {
+			if strings.Contains(html, phrase) {
+				return page.err
+			}
+		}
+	}
+	return nil
+}
+
+// pageError : Error of res when it is an interstitial page of Google Drive. The body is restored
+// so that it can be read again when the page is not recognised.
+func pageError(res *http.Response) error {
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 256*1024))
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return classifyPage(string(body))
+}
+
+// downloadWaitingQuota : download. With WaitQuota, a file whose download quota is exceeded is polled with
+// exponential backoff until the quota resets. Each attempt starts from a copy of p, which is returned.
+func (p *para) downloadWaitingQuota(ctx context.Context, url string) (*para, error) {
+	delay := p.WaitQuota
+	for {
+		q := p.Clone()
+		err := q.download(ctx, url)
+		if p.WaitQuota <= 0 || q.DlFolder || !errors.Is(err, ErrQuotaExceeded) {
+			return q, err
+		}
+		d := delay/2 + rand.N(delay/2+1)
+		if !p.Disp && !p.MCPMode {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[*] Download quota of file ID [ %s ] is exceeded. Trying again in %v.\n", q.ID, d.Round(time.Second))
+			p.mu.Unlock()
+		}
+		if err := sleepContext(ctx, d); err != nil {
+			return q, err
+		}
+		delay = min(delay*2, maxQuotaPoll)
+	}
+}
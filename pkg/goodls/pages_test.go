@@ -0,0 +1,52 @@
+package goodls
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClassifyPage(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want error
+	}{
+		{"quota", `<html><title>Google Drive - Quota exceeded</title><body><p>Sorry, you can't view or download this file at this time.</p><p>Too many users have viewed or downloaded this file recently. Please try accessing the file again later.</p></body></html>`, ErrQuotaExceeded},
+		{"deleted", `<html><title>Google Drive - Page Not Found</title><body><p>Sorry, the file you have requested does not exist.</p></body></html>`, ErrFileDeleted},
+		{"trash", `<html><body><p>This file is in the owner&#39;s trash.</p></body></html>`, ErrFileDeleted},
+		{"login", `<html><body><a href="https://accounts.google.com/ServiceLogin?service=wise&amp;continue=https://drive.google.com/">Sign in</a></body></html>`, ErrLoginRequired},
+		{"access", `<html><body><h1>You need access</h1><p>Ask for access, or switch to an account with access.</p></body></html>`, ErrLoginRequired},
+		{"virus scan", `<html><body><p>large.bin (1.2G) is too large for Google to scan for viruses. Would you still like to download this file?</p></body></html>`, ErrVirusScanTooLarge},
+		{"other", `<html><body><p>Hello</p></body></html>`, nil},
+	}
+	for _, tt := range tests {
+		if got := classifyPage(tt.html); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The wrapped sentinels keep the exit codes of the older versions.
+	if !errors.Is(ErrFileDeleted, ErrNotFound) || !errors.Is(ErrLoginRequired, ErrNotShared) || !errors.Is(ErrVirusScanTooLarge, ErrEndpointChanged) {
+		t.Error("the errors of the pages do not wrap the older sentinels")
+	}
+}
+
+func TestPageError(t *testing.T) {
+	body := "<html><body>Too many users have viewed or downloaded this file recently.</body></html>"
+	res := &http.Response{Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, Body: io.NopCloser(strings.NewReader(body))}
+	if err := pageError(res); err != ErrQuotaExceeded {
+		t.Errorf("err = %v, want ErrQuotaExceeded", err)
+	}
+
+	body = `{"error":{"code":403}}`
+	res = &http.Response{Header: http.Header{"Content-Type": {"application/json"}}, Body: io.NopCloser(strings.NewReader(body))}
+	if err := pageError(res); err != nil {
+		t.Errorf("err = %v for JSON", err)
+	}
+	if b, _ := io.ReadAll(res.Body); string(b) != body {
+		t.Errorf("body = %q, want it to be kept", b)
+	}
+}
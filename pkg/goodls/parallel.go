@@ -0,0 +1,104 @@
+package goodls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultMinPartSize : Files smaller than twice this size are downloaded over one connection.
+const defaultMinPartSize = 8 << 20
+
+// errRangeUnsupported : The server answered a Range request with the whole content.
+var errRangeUnsupported = errors.New("range requests are not supported")
+
+// byteRange : Inclusive byte range of a part of a file.
+type byteRange struct {
+	Start int64
+	End   int64
+}
+
+// splitRanges : Split size bytes into n ranges of almost the same length.
+func splitRanges(size int64, n int) []byteRange {
+	partSize := size / int64(n)
+	ranges := make([]byteRange, n)
+	for i := range ranges {
+		ranges[i].Start = int64(i) * partSize
+		ranges[i].End = ranges[i].Start + partSize - 1
+	}
+	ranges[n-1].End = size - 1
+	return ranges
+}
+
+// numParts : Number of parts for downloading the content of res over several connections.
+// 1 is returned when the size is unknown, the server does not accept ranges or the file is small.
+func (p *para) numParts(res *http.Response) int {
+	if p.Connections < 2 || p.DownloadBytes != -1 || res.StatusCode != http.StatusOK || res.Request == nil {
+		return 1
+	}
+	if p.Size <= 0 || res.ContentLength != p.Size || res.Header.Get("Content-Encoding") != "" || res.Uncompressed {
+		return 1
+	}
+	// Drive API honours Range without announcing it.
+	if res.Header.Get("Accept-Ranges") != "bytes" && p.APIKey == "" {
+		return 1
+	}
+	minPartSize := p.MinPartSize
+	if minPartSize <= 0 {
+		minPartSize = defaultMinPartSize
+	}
+	return int(max(1, min(int64(p.Connections), p.Size/minPartSize)))
+}
+
+// fetchRange : Fetch a range of url. errRangeUnsupported is returned when the server ignores the range.
+func (p *para) fetchRange(ctx context.Context, url string, r byteRange) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.Start, r.End))
+	res, err := p.fetchWithHeader(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusOK {
+		res.Body.Close()
+		return nil, errRangeUnsupported
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		return nil, &FileError{ID: p.ID, Err: newHTTPError(res)}
+	}
+	if start, ok := contentRangeStart(res.Header.Get("Content-Range")); !ok || start != r.Start {
+		res.Body.Close()
+		return nil, errRangeUnsupported
+	}
+	return res, nil
+}
+
+// contentRangeStart : First byte position of "Content-Range: bytes start-end/size".
+func contentRangeStart(s string) (int64, bool) {
+	s, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	s, _, ok = strings.Cut(s, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(s, 10, 64)
+	return start, err == nil
+}
+
+// contentRangeSize : Complete length of "Content-Range: bytes start-end/size".
+func contentRangeSize(s string) (int64, bool) {
+	s, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	_, s, ok = strings.Cut(s, "/")
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	return size, err == nil
+}
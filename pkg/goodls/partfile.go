@@ -0,0 +1,461 @@
+package goodls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"golang.org/x/sync/errgroup"
+)
+
+// Suffixes of the files of an unfinished download. "<name>.part" holds the data and "<name>.part.json" is its journal.
+const (
+	partSuffix    = ".part"
+	journalSuffix = ".part.json"
+)
+
+// journalInterval : Interval of saving the journal during a download.
+const journalInterval = 2 * time.Second
+
+// journal : Sidecar of a .part file. It records which bytes have been written so that a rerun can continue.
+type journal struct {
+	ID    string
+	Size  int64
+	MD5   string `json:",omitempty"`
+	ETag  string `json:",omitempty"`
+	Parts []journalPart
+
+	path string
+	mu   sync.Mutex
+}
+
+// journalPart : Byte range of a part and the number of bytes written from its start.
+type journalPart struct {
+	Start int64
+	End   int64
+	Done  int64
+}
+
+// remaining : Number of bytes which have not been written.
+func (jp journalPart) remaining() int64 {
+	return jp.End - jp.Start + 1 - jp.Done
+}
+
+// newJournal : Create a journal of a file split into ranges.
+func newJournal(path, id string, size int64, md5sum, etag string, ranges []byteRange) *journal {
+	j := &journal{ID: id, Size: size, MD5: md5sum, ETag: etag, path: path}
+	for _, r := range ranges {
+		j.Parts = append(j.Parts, journalPart{Start: r.Start, End: r.End})
+	}
+	return j
+}
+
+// loadJournal : Load the journal at path. nil is returned when it does not exist or cannot be used for the file.
+func loadJournal(path, id string, size int64, md5sum, etag string) *journal {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	j := &journal{path: path}
+	if err := json.Unmarshal(b, j); err != nil || len(j.Parts) == 0 {
+		return nil
+	}
+	// The file on Google Drive has been changed since the last run.
+	if j.ID != id || j.Size != size || (j.MD5 != "" && md5sum != "" && j.MD5 != md5sum) || (j.ETag != "" && etag != "" && j.ETag != etag) {
+		return nil
+	}
+	for _, jp := range j.Parts {
+		if jp.Done < 0 || jp.remaining() < 0 {
+			return nil
+		}
+	}
+	return j
+}
+
+// done : Total number of written bytes.
+func (j *journal) done() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var n int64
+	for _, jp := range j.Parts {
+		n += jp.Done
+	}
+	return n
+}
+
+// part : Copy of the i-th part.
+func (j *journal) part(i int) journalPart {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.Parts[i]
+}
+
+// next : Offset of the first byte which has not been written.
+func (j *journal) next() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, jp := range j.Parts {
+		if jp.remaining() > 0 {
+			return jp.Start + jp.Done
+		}
+	}
+	return j.Size
+}
+
+// advance : Record n bytes written to the i-th part.
+func (j *journal) advance(i int, n int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Parts[i].Done += n
+}
+
+// reset : Start over with one part covering the whole file.
+func (j *journal) reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Parts = []journalPart{{Start: 0, End: j.Size - 1}}
+}
+
+// save : Write the journal atomically. The progress is copied before file is synced, so that the journal never
+// claims bytes which were written after the sync.
+func (j *journal) save(file *os.File) error {
+	j.mu.Lock()
+	snapshot := &journal{ID: j.ID, Size: j.Size, MD5: j.MD5, ETag: j.ETag, Parts: slices.Clone(j.Parts)}
+	j.mu.Unlock()
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// autosave : Save the journal periodically until the returned function is called. The function saves it a last time.
+func (j *journal) autosave(file *os.File) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(journalInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				j.save(file)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+		j.save(file)
+	}
+}
+
+// journalWriter : Writer of the i-th part which records the progress in the journal.
+type journalWriter struct {
+	file *os.File
+	j    *journal
+	i    int
+}
+
+// Write : Implement io.Writer.
+func (w *journalWriter) Write(b []byte) (int, error) {
+	jp := w.j.part(w.i)
+	n, err := w.file.WriteAt(b, jp.Start+jp.Done)
+	w.j.advance(w.i, int64(n))
+	return n, err
+}
+
+// copyJournalPart : Write the remaining bytes of the i-th part from body. The bytes are also written to h when it is not nil.
+// A broken, stalled or truncated body is reported as *streamError.
+func (p *para) copyJournalPart(ctx context.Context, file *os.File, body io.ReadCloser, j *journal, i int, bar *mpb.Bar, h *hasher) error {
+	remaining := j.part(i).remaining()
+	r := io.LimitReader(p.bodyReader(ctx, &streamReader{r: p.watchStall(body)}, bar), remaining)
+	if h != nil {
+		r = io.TeeReader(r, h)
+	}
+	n, err := io.Copy(&journalWriter{file: file, j: j, i: i}, r)
+	if err == nil && n != remaining {
+		err = &streamError{err: io.ErrUnexpectedEOF}
+	}
+	return err
+}
+
+// downloadPart : Write the remaining bytes of the i-th part. When body is nil, the part is fetched with a Range request.
+// A broken stream is resumed with a Range request from the last written byte. The retries of the policy are
+// counted from the last progress, so a stream which keeps moving is always reconnected while the retries are enabled.
+func (p *para) downloadPart(ctx context.Context, url string, file *os.File, body io.ReadCloser, j *journal, i int, bar *mpb.Bar, h *hasher) error {
+	rp := p.retryPolicy()
+	start := time.Now()
+	for attempt := 0; ; {
+		jp := j.part(i)
+		if body == nil {
+			res, err := p.fetchRange(ctx, url, byteRange{Start: jp.Start + jp.Done, End: jp.End})
+			if err != nil {
+				return err
+			}
+			body = res.Body
+		}
+		err := p.copyJournalPart(ctx, file, body, j, i, bar, h)
+		body.Close()
+		body = nil
+		var streamErr *streamError
+		if err == nil || ctx.Err() != nil || !errors.As(err, &streamErr) || rp.Retries == 0 {
+			return err
+		}
+		if j.part(i).Done > jp.Done {
+			attempt, start = 0, time.Now()
+		}
+		d, ok := rp.next(attempt, start, nil)
+		if !ok {
+			return err
+		}
+		attempt++
+		if p.Verbose {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] Connection of '%s' broke at byte %d: %v. Reconnecting in %v\n", p.Filename, jp.Start+j.part(i).Done, err, d)
+			p.mu.Unlock()
+		}
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// savePartFile : Save the content of res to "<targetPath>.part" and rename it to targetPath when it is complete and verified.
+// When the size is known, the progress is recorded in the journal "<targetPath>.part.json". A rerun continues
+// from the journal with Range requests, and a failed or cancelled download keeps both files.
+// With '--verify', a file whose checksums do not match is deleted and downloaded again.
+func (p *para) savePartFile(ctx context.Context, res *http.Response, targetPath string, bar *mpb.Bar) (checksums, error) {
+	url := res.Request.URL.String()
+	for attempt := 0; ; attempt++ {
+		sums, err := p.writePartFile(ctx, res, targetPath, bar)
+		res.Body.Close()
+		if !p.Verify || !errors.Is(err, ErrChecksumMismatch) || attempt >= max(p.Retry, 1) {
+			return sums, err
+		}
+
+		if !p.Disp && !p.MCPMode {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[*] %v. Downloading '%s' again.\n", err, p.Filename)
+			p.mu.Unlock()
+		}
+		if bar != nil {
+			bar.SetCurrent(0)
+		}
+		if res, err = p.fetch(ctx, url); err != nil {
+			return checksums{}, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return checksums{}, &FileError{ID: p.ID, Err: newHTTPError(res)}
+		}
+	}
+}
+
+// writePartFile : One attempt of savePartFile. The part file and the journal are removed when the checksums do not match.
+func (p *para) writePartFile(ctx context.Context, res *http.Response, targetPath string, bar *mpb.Bar) (checksums, error) {
+	partPath := targetPath + partSuffix
+	journalPath := targetPath + journalSuffix
+
+	if p.Size <= 0 {
+		// The size is unknown, e.g. an exported Google Docs file, so the download cannot be resumed.
+		sums, err := p.saveUnknownSize(ctx, res, partPath, bar)
+		if err == nil {
+			sums.Verification, err = p.verify(sums)
+		}
+		if err != nil {
+			os.Remove(partPath)
+			return sums, err
+		}
+		return sums, os.Rename(partPath, targetPath)
+	}
+
+	etag := res.Header.Get("ETag")
+	var file *os.File
+	j := loadJournal(journalPath, p.ID, p.Size, p.MD5Checksum, etag)
+	if j != nil {
+		f, err := os.OpenFile(partPath, os.O_WRONLY, 0666)
+		if err != nil {
+			j = nil
+		} else if info, err := f.Stat(); err != nil || info.Size() != p.Size {
+			f.Close()
+			j = nil
+		} else {
+			file = f
+		}
+	}
+	if j == nil {
+		f, err := os.Create(partPath)
+		if err != nil {
+			return checksums{}, err
+		}
+		file = f
+		if err := file.Truncate(p.Size); err != nil {
+			file.Close()
+			return checksums{}, err
+		}
+		j = newJournal(journalPath, p.ID, p.Size, p.MD5Checksum, etag, splitRanges(p.Size, p.numParts(res)))
+	} else if p.Verbose {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[Verbose] Resuming '%s' from %d of %d bytes\n", p.Filename, j.done(), p.Size)
+		p.mu.Unlock()
+	}
+	defer file.Close()
+	if err := j.save(file); err != nil {
+		return checksums{}, err
+	}
+	if bar != nil {
+		bar.SetCurrent(j.done())
+	}
+
+	stop := j.autosave(file)
+	h, err := p.downloadJournal(ctx, res, file, j, bar)
+	stop()
+	if err != nil {
+		return checksums{}, err
+	}
+	if err := file.Close(); err != nil {
+		return checksums{}, err
+	}
+
+	// A resumed file or a file downloaded in parts is hashed after it has been written.
+	var sums checksums
+	if h != nil {
+		sums = h.sums()
+	} else if sums, err = fileChecksums(partPath, p.Verify); err != nil {
+		return checksums{}, err
+	}
+	if sums.Verification, err = p.verify(sums); err != nil {
+		os.Remove(partPath)
+		os.Remove(journalPath)
+		return sums, err
+	}
+	if err := os.Rename(partPath, targetPath); err != nil {
+		return checksums{}, err
+	}
+	os.Remove(journalPath)
+	return sums, nil
+}
+
+// saveUnknownSize : Save the content of res to partPath over one connection.
+func (p *para) saveUnknownSize(ctx context.Context, res *http.Response, partPath string, bar *mpb.Bar) (checksums, error) {
+	file, err := os.Create(partPath)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer file.Close()
+	h := newHasher(p.Verify)
+	if _, err := io.Copy(file, io.TeeReader(p.bodyReader(ctx, p.watchStall(res.Body), bar), h)); err != nil {
+		return checksums{}, err
+	}
+	return h.sums(), file.Close()
+}
+
+// downloadJournal : Download the remaining parts of the journal concurrently and write them at their offsets in file.
+// The body of res is used for the part which continues from its first byte, which is byte 0 unless res answers
+// a Range request. Other parts are fetched with Range requests.
+// When the server does not honour Range, the whole content is downloaded again over one connection.
+// The hasher is returned when the whole content has been written in one stream, otherwise nil.
+func (p *para) downloadJournal(ctx context.Context, res *http.Response, file *os.File, j *journal, bar *mpb.Bar) (*hasher, error) {
+	url := res.Request.URL.String()
+	var h *hasher
+
+	if p.Verbose && len(j.Parts) > 1 {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[Verbose] Downloading '%s' over %d connections\n", p.Filename, len(j.Parts))
+		p.mu.Unlock()
+	}
+
+	var offset int64
+	if res.StatusCode == http.StatusPartialContent {
+		if start, ok := contentRangeStart(res.Header.Get("Content-Range")); ok {
+			offset = start
+		} else {
+			offset = -1
+		}
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	first := res.Body
+	for i := range j.Parts {
+		i := i
+		jp := j.part(i)
+		if jp.remaining() == 0 {
+			continue
+		}
+		if jp.Start+jp.Done == offset && first != nil {
+			body := first
+			first = nil
+			if len(j.Parts) == 1 && offset == 0 {
+				h = newHasher(p.Verify)
+			}
+			eg.Go(func() error {
+				return p.downloadPart(egCtx, url, file, body, j, i, bar, h)
+			})
+			continue
+		}
+		eg.Go(func() error {
+			return p.downloadPart(egCtx, url, file, nil, j, i, bar, nil)
+		})
+	}
+	if first != nil {
+		// A resumed download does not use a response from another byte.
+		res.Body.Close()
+	}
+	// Closing the body unblocks its copy when another part has failed.
+	go func() {
+		<-egCtx.Done()
+		res.Body.Close()
+	}()
+	err := eg.Wait()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if !errors.Is(err, errRangeUnsupported) {
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+
+	if p.Verbose {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[Verbose] %v. Downloading '%s' over one connection\n", err, p.Filename)
+		p.mu.Unlock()
+	}
+	j.reset()
+	if bar != nil {
+		bar.SetCurrent(0)
+	}
+	fullRes, err := p.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer fullRes.Body.Close()
+	if fullRes.StatusCode != http.StatusOK {
+		return nil, &FileError{ID: p.ID, Err: newHTTPError(fullRes)}
+	}
+	h = newHasher(p.Verify)
+	if err := p.downloadPart(ctx, url, file, fullRes.Body, j, 0, bar, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
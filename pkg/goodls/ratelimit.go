@@ -0,0 +1,109 @@
+package goodls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateChunk : Maximum number of bytes read at once through a RateLimiter, which keeps the rate smooth.
+const rateChunk = 32 * 1024
+
+// RateLimiter : Token bucket which limits the total bandwidth of the downloads sharing it.
+// A RateLimiter is safe for concurrent use by multiple goroutines.
+type RateLimiter struct {
+	rate   float64 // Bytes per second
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter : Create a RateLimiter of bytesPerSec. The bucket starts empty and holds up to one second of tokens.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{
+		rate:  float64(bytesPerSec),
+		burst: float64(max(bytesPerSec, rateChunk)),
+		last:  time.Now(),
+	}
+}
+
+// WaitN : Take n tokens, waiting until they are available or ctx is done.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// Taking the tokens in advance queues the callers in order.
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, wait)
+}
+
+// rateReader : Reader whose bandwidth is limited by every limiter.
+type rateReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*RateLimiter
+}
+
+// Read : Implement io.Reader.
+func (r *rateReader) Read(b []byte) (int, error) {
+	if len(b) > rateChunk {
+		b = b[:rateChunk]
+	}
+	n, err := r.r.Read(b)
+	for _, l := range r.limiters {
+		if werr := l.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// limitReader : Limit the bandwidth of r with the limiter shared by all downloads and the limiter of the current file.
+func (p *para) limitReader(ctx context.Context, r io.Reader) io.Reader {
+	var limiters []*RateLimiter
+	for _, l := range []*RateLimiter{p.RateLimiter, p.fileLimiter} {
+		if l != nil {
+			limiters = append(limiters, l)
+		}
+	}
+	if len(limiters) == 0 {
+		return r
+	}
+	return &rateReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+// ParseRate : Parse a rate such as "500k", "5M" or "1.5g" into bytes per second. The units are powers of 1024.
+func ParseRate(s string) (int64, error) {
+	m := regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([kmg]?)b?$`).FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("wrong rate: %s", s)
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	switch m[2] {
+	case "k":
+		f *= 1 << 10
+	case "m":
+		f *= 1 << 20
+	case "g":
+		f *= 1 << 30
+	}
+	if f < 1 {
+		return 0, fmt.Errorf("wrong rate: %s", s)
+	}
+	return int64(f), nil
+}
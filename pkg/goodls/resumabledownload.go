@@ -0,0 +1,569 @@
+package goodls
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// valResumableDownload : Structure for resumable download
+type valResumableDownload struct {
+	para
+	dlParams
+}
+
+// dlParams : Parameters for downloading
+type dlParams struct {
+	CurrentFileSize int64
+	DownloadFile    *drive.File
+	OutMimeType     string
+	Range           string
+	Start           int64
+	End             int64
+	MediaURL        string // Download URL of the anonymous flow. Drive API is used when it is empty.
+}
+
+// getFileInfFromP : Retrieve file information from *para.
+func (p *para) getFileInfFromP(ctx context.Context) (*drive.File, error) {
+	v := &valResumableDownload{
+		para: *p,
+	}
+	if err := v.getFileInf(ctx); err != nil {
+		return nil, err
+	}
+	return v.DownloadFile, nil
+}
+
+// showFileInf : Show file information.
+func (p *para) showFileInf(ctx context.Context) error {
+	dlfile, err := p.getFileInfFromP(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := json.Marshal(dlfile)
+	if err != nil {
+		return err
+	}
+	if !p.MCPMode {
+		fmt.Printf("%s\n", r)
+	}
+	return nil
+}
+
+// getDownloadBytes : Get download size for resumable download.
+func getDownloadBytes(size string) (int64, error) {
+	reg := regexp.MustCompile("^([0-9.]+)$|^([0-9.]+)([bkmgt])")
+	regRes := reg.FindStringSubmatch(strings.ToLower(size))
+	switch {
+	case len(regRes) == 0:
+		return 0, fmt.Errorf("wrong size: %s", size)
+	case regRes[1] != "":
+		s, err := strconv.ParseInt(regRes[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return s, nil
+	case regRes[2] != "" && regRes[3] != "":
+		f, err := strconv.ParseFloat(regRes[2], 64)
+		if err != nil {
+			return 0, err
+		}
+		switch regRes[3] {
+		case "k":
+			f *= 1000
+		case "m":
+			f *= 1000000
+		case "g":
+			f *= 1000000000
+		case "t":
+			f *= 1000000000000
+		}
+		s := int64(f)
+		if s < 10000000 {
+			return 10000000, nil
+		}
+		return s, nil
+	default:
+		return 0, fmt.Errorf("unexpected error '%s'", size)
+	}
+}
+
+// resDownloadFileByAPIKey : Resumable download by API key.
+func (v *valResumableDownload) resDownloadFileByAPIKey(ctx context.Context) (*http.Response, error) {
+	u, err := url.Parse(v.Endpoints.filesURL())
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, v.DownloadFile.Id)
+	q := u.Query()
+	q.Set("alt", "media")
+	q.Set("key", v.APIKey)
+	q.Set("supportsAllDrives", "true") // Added Shared Drive Support Explicitly
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", v.Range)
+	res, err := v.doWithRetry(req, v.Client.Do)
+	if err != nil {
+		return nil, fmt.Errorf("failed resumable fetch: %w", err)
+	}
+	if res.StatusCode != 206 && res.StatusCode != 200 {
+		return nil, &FileError{ID: v.DownloadFile.Id, Err: newHTTPError(res)}
+	}
+	return res, nil
+}
+
+// fetchChunk : Fetch the range of the current chunk from Drive API, or from the download URL of the anonymous flow.
+func (v *valResumableDownload) fetchChunk(ctx context.Context) (*http.Response, error) {
+	if v.MediaURL == "" {
+		return v.resDownloadFileByAPIKey(ctx)
+	}
+	header := http.Header{}
+	header.Set("Range", v.Range)
+	res, err := v.fetchWithHeader(ctx, v.MediaURL, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed resumable fetch: %w", err)
+	}
+	if res.StatusCode != 206 && res.StatusCode != 200 {
+		return nil, &FileError{ID: v.ID, Err: newHTTPError(res)}
+	}
+	return res, nil
+}
+
+// getFileInfAnonymous : Retrieve the name and the size of the file without an API key. The download URL is resolved
+// through the virus scan warning page like a normal download, and its first byte is requested with Range.
+// When the endpoint does not honour Range, the response of the whole content is returned to be saved as it is.
+func (v *valResumableDownload) getFileInfAnonymous(ctx context.Context) (*http.Response, error) {
+	v.Client = v.newCookieClient()
+	res, err := v.fetch(ctx, v.URL)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		if err := pageError(res); err != nil {
+			res.Body.Close()
+			return nil, &FileError{ID: v.ID, Err: err}
+		}
+		return nil, &FileError{ID: v.ID, Err: newHTTPError(res)}
+	}
+	if _, ok := res.Header["Content-Disposition"]; ok {
+		res.Body.Close()
+		v.MediaURL = v.URL
+	} else {
+		defer res.Body.Close()
+		if isSignInPage(res) {
+			return nil, &FileError{ID: v.ID, Err: ErrLoginRequired}
+		}
+		if err := v.getURLFromHTML(res); err != nil {
+			return nil, &FileError{ID: v.ID, Err: err}
+		}
+		if v.URLForLargeFile == "" {
+			return nil, &FileError{ID: v.ID, Err: ErrNotShared}
+		}
+		v.MediaURL = v.URLForLargeFile
+	}
+
+	header := http.Header{}
+	header.Set("Range", "bytes=0-0")
+	probe, err := v.fetchWithHeader(ctx, v.MediaURL, header)
+	if err != nil {
+		return nil, err
+	}
+	v.DownloadFile = &drive.File{
+		Id:       v.ID,
+		Name:     dispositionFilename(probe),
+		MimeType: probe.Header.Get("Content-Type"),
+	}
+	// Without "Content-Disposition", the file is named after its ID.
+	if v.DownloadFile.Name == "" {
+		v.DownloadFile.Name = v.ID
+	}
+	if t, err := http.ParseTime(probe.Header.Get("Last-Modified")); err == nil {
+		v.DownloadFile.ModifiedTime = t.UTC().Format(time.RFC3339)
+	}
+	switch probe.StatusCode {
+	case http.StatusPartialContent:
+		probe.Body.Close()
+		size, ok := contentRangeSize(probe.Header.Get("Content-Range"))
+		if !ok {
+			return nil, &FileError{ID: v.ID, Err: fmt.Errorf("%w: Content-Range is %q", ErrEndpointChanged, probe.Header.Get("Content-Range"))}
+		}
+		v.DownloadFile.Size = size
+		return nil, nil
+	case http.StatusOK:
+		if v.Verbose {
+			v.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] %s ignored the Range request\n", redactKey(probe.Request.URL))
+			v.mu.Unlock()
+		}
+		v.DownloadFile.Size = probe.ContentLength
+		return probe, nil
+	}
+	return nil, &FileError{ID: v.ID, Err: newHTTPError(probe)}
+}
+
+// dispositionFilename : Filename of the "Content-Disposition" header of res.
+func dispositionFilename(res *http.Response) string {
+	_, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// saveWhole : Save the whole content of res, which is the answer of an endpoint ignoring Range, instead of a chunk.
+// A partial local file is replaced when the download is complete.
+func (v *valResumableDownload) saveWhole(ctx context.Context, res *http.Response) error {
+	if !v.Disp && !v.MCPMode {
+		v.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[*] The download URL does not support Range requests. Downloading the whole file '%s' instead.\n", v.Filename)
+		v.mu.Unlock()
+	}
+	v.para.DownloadBytes = -1
+	v.para.Size = v.DownloadFile.Size
+	v.para.MD5Checksum = v.DownloadFile.Md5Checksum
+	if v.CurrentFileSize > 0 {
+		v.ConflictResolved = true
+		v.ConflictAction = ActionOverwritten
+	}
+	return v.para.saveFile(ctx, res)
+}
+
+// isWholeFile : Check whether res of the current chunk has the whole content although a part was requested.
+func (v *valResumableDownload) isWholeFile(res *http.Response) bool {
+	return res.StatusCode == http.StatusOK && (v.Start != 0 || v.End != v.DownloadFile.Size-1)
+}
+
+// getFileInf : Retrieve file infomation using Drive API.
+func (v *valResumableDownload) getFileInf(ctx context.Context) error {
+	srv, err := v.para.newDriveService(ctx)
+	if err != nil {
+		return err
+	}
+	fields := []googleapi.Field{"createdTime,id,md5Checksum,mimeType,modifiedTime,name,owners,parents,sha256Checksum,shared,size,webContentLink,webViewLink"}
+	res, err := srv.Files.Get(v.ID).Fields(fields...).SupportsAllDrives(true).Context(ctx).Do()
+	if err != nil {
+		return fromAPIError(v.ID, err)
+	}
+	v.DownloadFile = res
+	return nil
+}
+
+// chkResumeFile : Check file and file size of local file.
+func (v *valResumableDownload) chkResumeFile() (bool, bool, error) {
+	if v.Filename == "" {
+		v.Filename = v.DownloadFile.Name
+	}
+	f, err := os.Stat(filepath.Join(v.WorkDir, v.Filename))
+	if err != nil {
+		v.CurrentFileSize = 0
+		v.Start = 0
+		v.End = func() int64 {
+			if v.DownloadBytes >= v.DownloadFile.Size {
+				return v.DownloadFile.Size - 1
+			}
+			return v.DownloadBytes - 1
+		}()
+		v.Range = fmt.Sprintf("bytes=0-%d", v.End)
+		v.Size = v.End + 1
+		return false, false, nil
+	}
+	fs := f.Size()
+	v.CurrentFileSize = fs
+	if fs == v.DownloadFile.Size {
+		return false, true, nil
+	} else if fs > v.DownloadFile.Size {
+		return false, false, fmt.Errorf("size of download file is larger than that of local file. Please confirm the file and URL. FileName is %s. Download URL is %s", v.Filename, v.URL)
+	}
+	v.Start = fs
+	v.End = func() int64 {
+		if fs+v.DownloadBytes >= v.DownloadFile.Size {
+			return v.DownloadFile.Size - 1
+		}
+		return fs + v.DownloadBytes - 1
+	}()
+	v.Range = fmt.Sprintf("bytes=%d-%d", v.Start, v.End)
+	v.Size = v.End - v.Start + 1
+	return true, false, nil
+}
+
+// ResumableStatus : Status of a resumable download with '-r'. It is printed as one JSON line to stderr before each chunk
+// and when the file is complete.
+type ResumableStatus struct {
+	Status        string       `json:"Status"`                 // "new", "resume" or "completed"
+	Filename      string       `json:"Filename"`               // Local filename
+	DriveFilename string       `json:"DriveFilename"`          // Filename on Google Drive
+	LocalSize     int64        `json:"LocalSize"`              // Current size of the local file in bytes
+	DriveSize     int64        `json:"DriveSize"`              // Size of the file on Google Drive in bytes
+	ChunkSize     int64        `json:"ChunkSize,omitempty"`    // Size of the next chunk in bytes
+	DriveMD5      string       `json:"DriveMD5,omitempty"`     // md5Checksum on Google Drive
+	LocalMD5      string       `json:"LocalMD5,omitempty"`     // md5 of the completed local file
+	Verification  Verification `json:"Verification,omitempty"` // Comparison of the md5 checksums
+}
+
+// Statuses of ResumableStatus.
+const (
+	resumableNew       = "new"
+	resumableResume    = "resume"
+	resumableCompleted = "completed"
+)
+
+// status : Status of the current chunk. fc and end are the results of chkResumeFile.
+func (v *valResumableDownload) status(fc, end bool) ResumableStatus {
+	st := ResumableStatus{
+		Status:        resumableNew,
+		Filename:      v.Filename,
+		DriveFilename: v.DownloadFile.Name,
+		LocalSize:     v.CurrentFileSize,
+		DriveSize:     v.DownloadFile.Size,
+	}
+	switch {
+	case end:
+		st.Status = resumableCompleted
+		st.DriveMD5 = v.DownloadFile.Md5Checksum
+	case fc:
+		st.Status = resumableResume
+		st.ChunkSize = v.Size
+	default:
+		st.ChunkSize = v.Size
+	}
+	return st
+}
+
+// printStatus : Print st as one JSON line to stderr.
+func (v *valResumableDownload) printStatus(st ResumableStatus) {
+	if v.MCPMode {
+		return
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	v.mu.Lock()
+	fmt.Fprintf(os.Stderr, "%s\n", b)
+	v.mu.Unlock()
+}
+
+// verifyLocalFile : Compare the md5 of the completed local file with md5Checksum on Google Drive, and with '--verify'
+// also the sha256 with sha256Checksum.
+func (v *valResumableDownload) verifyLocalFile(targetPath string) (ResumableStatus, checksums, error) {
+	st := v.status(false, true)
+	sums, err := fileChecksums(targetPath, v.Verify)
+	if err != nil {
+		return st, sums, err
+	}
+	v.MD5Checksum = v.DownloadFile.Md5Checksum
+	v.SHA256Checksum = v.DownloadFile.Sha256Checksum
+	sums.Verification, err = v.verify(sums)
+	st.LocalMD5 = sums.MD5
+	st.Verification = sums.Verification
+	return st, sums, err
+}
+
+// appendChunk : Append the content of res of the current chunk to the local file.
+// The file is synced, so its size is the progress from which the next chunk or the next run continues.
+func (v *valResumableDownload) appendChunk(ctx context.Context, res *http.Response, targetPath string, bar *mpb.Bar) error {
+	defer res.Body.Close()
+	// Appending the whole content to a partial file would corrupt it.
+	if v.isWholeFile(res) {
+		return &FileError{ID: v.ID, Err: errRangeUnsupported}
+	}
+	if res.StatusCode == http.StatusPartialContent {
+		if start, ok := contentRangeStart(res.Header.Get("Content-Range")); !ok || start != v.Start {
+			return &FileError{ID: v.ID, Err: errRangeUnsupported}
+		}
+	}
+
+	file, err := os.OpenFile(targetPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	n, err := io.Copy(file, io.LimitReader(v.bodyReader(ctx, v.watchStall(res.Body), bar), v.Size))
+	if err == nil && n != v.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	if serr := file.Sync(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// resumeUntilDone : Download the file chunk by chunk until it is complete, and verify its md5 at the end.
+// A failed chunk is retried by the retry policy, whose count starts again whenever the local file grows.
+func (v *valResumableDownload) resumeUntilDone(ctx context.Context) error {
+	targetPath := filepath.Join(v.WorkDir, v.Filename)
+	if err := v.checkFreeSpace(v.WorkDir, v.DownloadFile.Size-v.CurrentFileSize); err != nil {
+		return &FileError{ID: v.ID, Err: err}
+	}
+	barP := v.para
+	barP.Size = v.DownloadFile.Size
+	bar := barP.newBar()
+	if bar != nil {
+		bar.SetCurrent(v.CurrentFileSize)
+	}
+
+	rp := v.retryPolicy()
+	attempt, start := 0, time.Now()
+	for {
+		fc, end, err := v.chkResumeFile()
+		if err != nil {
+			return err
+		}
+		if end {
+			break
+		}
+		v.printStatus(v.status(fc, end))
+		res, err := v.fetchChunk(ctx)
+		if err == nil && v.isWholeFile(res) {
+			if bar != nil {
+				bar.Abort(true)
+			}
+			return v.saveWhole(ctx, res)
+		}
+		if err == nil {
+			err = v.appendChunk(ctx, res, targetPath, bar)
+		}
+		if err == nil {
+			attempt, start = 0, time.Now()
+			continue
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if info, serr := os.Stat(targetPath); ctx.Err() == nil && serr == nil && info.Size() > v.CurrentFileSize {
+			attempt, start = 0, time.Now()
+		}
+		d, ok := rp.next(attempt, start, nil)
+		if ctx.Err() != nil || !ok {
+			if bar != nil {
+				bar.Abort(false)
+			}
+			return err
+		}
+		attempt++
+		if !v.MCPMode {
+			v.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[*] Chunk of '%s' failed: %v. Retrying in %v.\n", v.Filename, err, d)
+			v.mu.Unlock()
+		}
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+		if bar != nil {
+			if info, err := os.Stat(targetPath); err == nil {
+				bar.SetCurrent(info.Size())
+			}
+		}
+	}
+	if bar != nil {
+		bar.SetTotal(-1, true)
+	}
+
+	st, sums, err := v.verifyLocalFile(targetPath)
+	v.printStatus(st)
+	if err != nil {
+		return err
+	}
+	v.recordProvenance(targetPath, Provenance{ID: v.ID, MD5: sums.MD5, URL: v.SourceURL, ModifiedTime: driveTime(v.DownloadFile.ModifiedTime), MimeType: v.DownloadFile.MimeType})
+	v.preserveTimes(targetPath, driveTime(v.DownloadFile.ModifiedTime), driveTime(v.DownloadFile.CreatedTime))
+	var extracted []string
+	if v.Extract {
+		if extracted, err = v.extractArchive(targetPath); err != nil {
+			return err
+		}
+	}
+	v.addResult(Result{
+		Path:         targetPath,
+		Filename:     v.Filename,
+		Type:         v.Kind,
+		MimeType:     v.DownloadFile.MimeType,
+		FileSize:     v.CurrentFileSize,
+		MD5:          sums.MD5,
+		SHA256:       sums.SHA256,
+		Verification: sums.Verification,
+		Extracted:    extracted,
+	})
+	return nil
+}
+
+// resumableDownload : Main method of resumable download. Without an API key, the chunks are requested from
+// the download URL of the anonymous flow.
+func (p *para) resumableDownload(ctx context.Context) error {
+	v := &valResumableDownload{
+		para: *p,
+	}
+	var whole *http.Response
+	if p.APIKey != "" {
+		if err := v.getFileInf(ctx); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if whole, err = v.getFileInfAnonymous(ctx); err != nil {
+			return err
+		}
+	}
+	if strings.Contains(v.DownloadFile.MimeType, "application/vnd.google-apps") {
+		return fmt.Errorf("a Google Docs file cannot be resumable downloaded")
+	}
+	fc, end, err := v.chkResumeFile()
+	if err != nil {
+		if whole != nil {
+			whole.Body.Close()
+		}
+		return err
+	}
+	if end {
+		if whole != nil {
+			whole.Body.Close()
+		}
+		st, _, err := v.verifyLocalFile(filepath.Join(v.WorkDir, v.Filename))
+		v.printStatus(st)
+		return err
+	}
+	if whole != nil {
+		return v.saveWhole(ctx, whole)
+	}
+	if p.ResumeUntilDone {
+		return v.resumeUntilDone(ctx)
+	}
+
+	if !p.MCPMode {
+		v.printStatus(v.status(fc, end))
+		var input string
+		fmt.Fprintf(os.Stderr, "Do you start this download? [y or n] ... ")
+		if _, err := fmt.Scan(&input); err != nil {
+			return err
+		}
+		if input != "y" {
+			return nil
+		}
+	}
+	res, err := v.fetchChunk(ctx)
+	if err != nil {
+		return err
+	}
+	if v.isWholeFile(res) {
+		return v.saveWhole(ctx, res)
+	}
+	return v.para.saveFile(ctx, res)
+}
@@ -0,0 +1,226 @@
+package goodls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the retry policy.
+const (
+	defaultRetryMaxDelay   = time.Minute
+	defaultRetryMaxElapsed = 10 * time.Minute
+)
+
+// retryPolicy : When a failed request is retried and how long to wait before it.
+// It is shared by fetch, resDownloadFileByAPIKey, the Drive API client and the reconnection of broken streams.
+type retryPolicy struct {
+	Retries    int           // Max number of retries after the first attempt
+	BaseDelay  time.Duration // Base of the exponential backoff
+	MaxDelay   time.Duration // Upper bound of a backoff without Retry-After
+	MaxElapsed time.Duration // Requests are not retried after this time since the first attempt. 0 means no limit.
+}
+
+// retryPolicy : Retry policy of the current settings.
+func (p *para) retryPolicy() retryPolicy {
+	return retryPolicy{
+		Retries:    max(p.Retry, 0),
+		BaseDelay:  p.RetryDelay,
+		MaxDelay:   defaultRetryMaxDelay,
+		MaxElapsed: p.RetryMaxElapsed,
+	}
+}
+
+// backoff : Delay before the retry after attempt (0 for the first attempt). Retry-After of res is honoured,
+// otherwise the delay is chosen at random up to the exponential backoff ("full jitter").
+func (rp retryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if d, ok := retryAfter(res, time.Now()); ok {
+		return d
+	}
+	if rp.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := rp.BaseDelay << min(attempt, 30)
+	if ceiling <= 0 || (rp.MaxDelay > 0 && ceiling > rp.MaxDelay) {
+		ceiling = rp.MaxDelay
+	}
+	return rand.N(ceiling + 1)
+}
+
+// next : Delay before the retry after attempt. false is returned when the retry would exceed the limits of the policy.
+func (rp retryPolicy) next(attempt int, start time.Time, res *http.Response) (time.Duration, bool) {
+	if attempt >= rp.Retries {
+		return 0, false
+	}
+	d := rp.backoff(attempt, res)
+	if rp.MaxElapsed > 0 && time.Since(start)+d > rp.MaxElapsed {
+		return d, false
+	}
+	return d, true
+}
+
+// retryAfter : Delay of the "Retry-After" header of res, given in seconds or as an HTTP date.
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	v := strings.TrimSpace(res.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(s, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryable : Classify the result of a request. Network errors, 408, 429, 5xx except 501 and the rate limit errors
+// of Drive API are retryable. Cancellation, invalid URLs, TLS certificate errors and other responses are not.
+// The body of a throttled response is restored by isThrottled so that it can be read again.
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		var certErr *tls.CertificateVerificationError
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostnameErr x509.HostnameError
+		var invalidCert x509.CertificateInvalidError
+		var urlErr *url.Error
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return false
+		case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &invalidCert):
+			return false
+		case errors.As(err, &urlErr) && strings.Contains(urlErr.Err.Error(), "unsupported protocol scheme"):
+			return false
+		}
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented:
+		return false
+	case http.StatusForbidden:
+		return isThrottled(res)
+	}
+	return res.StatusCode >= 500
+}
+
+// doWithRetry : Send req with send, and retry it by the retry policy while the result is retryable.
+// A response which is not retryable is returned as it is. When the retries are exhausted,
+// the error of the last attempt is returned and a retryable response is converted to *HTTPError.
+// req must not have a body.
+func (p *para) doWithRetry(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	res, err := p.sendWithRetry(req, send)
+	if err == nil && retryable(res, nil) {
+		return nil, newHTTPError(res)
+	}
+	return res, err
+}
+
+// sendWithRetry : doWithRetry which returns the last response as it is when the retries are exhausted.
+func (p *para) sendWithRetry(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	ctx := req.Context()
+	rp := p.retryPolicy()
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		if p.Verbose {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] Fetching URL: %s (Attempt %d/%d)\n", redactKey(req.URL), attempt+1, rp.Retries+1)
+			p.mu.Unlock()
+		}
+		res, err := send(req.Clone(ctx))
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			if isThrottled(res) {
+				p.pool.throttled()
+			} else if res.StatusCode < 300 {
+				p.pool.succeeded()
+			}
+			if p.Verbose {
+				p.mu.Lock()
+				fmt.Fprintf(os.Stderr, "[Verbose] HTTP %d for %s\n", res.StatusCode, redactKey(req.URL))
+				p.mu.Unlock()
+			}
+		} else if p.Verbose {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] Error fetching %s: %v\n", redactKey(req.URL), err)
+			p.mu.Unlock()
+		}
+		if !retryable(res, err) {
+			return res, err
+		}
+
+		d, ok := rp.next(attempt, start, res)
+		if !ok {
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		if p.Verbose {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] Waiting %v before retry...\n", d)
+			p.mu.Unlock()
+		}
+		if err := sleepContext(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryTransport : RoundTripper which retries the requests of the Drive API client by the retry policy.
+// The last response is returned as it is so that the client can read the error of Drive API from it.
+type retryTransport struct {
+	p    *para
+	base http.RoundTripper
+}
+
+// RoundTrip : Implement http.RoundTripper. Only requests without a body are retried.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		return t.base.RoundTrip(req)
+	}
+	return t.p.sendWithRetry(req, t.base.RoundTrip)
+}
+
+// streamError : Error of reading a response body, e.g. a dropped connection. It can be resumed with a Range request.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// streamReader : Reader which wraps the read errors of a response body in streamError.
+type streamReader struct {
+	r io.Reader
+}
+
+// Read : Implement io.Reader.
+func (r *streamReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err != nil && err != io.EOF {
+		err = &streamError{err: err}
+	}
+	return n, err
+}
@@ -0,0 +1,98 @@
+package goodls
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		res := &http.Response{Header: http.Header{}}
+		if tt.value != "" {
+			res.Header.Set("Retry-After", tt.value)
+		}
+		if got, ok := retryAfter(res, now); got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	rp := retryPolicy{Retries: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt := 0; attempt < 10; attempt++ {
+		ceiling := min(time.Second<<attempt, 5*time.Second)
+		for i := 0; i < 20; i++ {
+			if d := rp.backoff(attempt, nil); d < 0 || d > ceiling {
+				t.Fatalf("backoff(%d) = %v, want within [0, %v]", attempt, d, ceiling)
+			}
+		}
+	}
+
+	// Retry-After is used as it is, even beyond MaxDelay.
+	res := &http.Response{Header: http.Header{"Retry-After": {"30"}}}
+	if d := rp.backoff(0, res); d != 30*time.Second {
+		t.Errorf("backoff with Retry-After = %v", d)
+	}
+
+	// The retry is given up when it would exceed MaxElapsed.
+	rp.MaxElapsed = 10 * time.Second
+	if _, ok := rp.next(0, time.Now(), res); ok {
+		t.Error("a retry beyond MaxElapsed was allowed")
+	}
+	if _, ok := rp.next(10, time.Now(), nil); ok {
+		t.Error("a retry beyond Retries was allowed")
+	}
+	if d, ok := (retryPolicy{Retries: 1}).next(0, time.Now(), nil); !ok || d != 0 {
+		t.Errorf("next without a delay = %v, %v", d, ok)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	response := func(status int, body string) *http.Response {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+	}
+	tests := []struct {
+		name string
+		res  *http.Response
+		err  error
+		want bool
+	}{
+		{"200", response(200, ""), nil, false},
+		{"404", response(404, ""), nil, false},
+		{"408", response(408, ""), nil, true},
+		{"429", response(429, ""), nil, true},
+		{"500", response(500, ""), nil, true},
+		{"501", response(501, ""), nil, false},
+		{"503", response(503, ""), nil, true},
+		{"403 rate limit", response(403, `{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`), nil, true},
+		{"403 quota", response(403, `{"error":{"errors":[{"reason":"downloadQuotaExceeded"}]}}`), nil, false},
+		{"connection reset", nil, &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection reset by peer")}, true},
+		{"unexpected EOF", nil, io.ErrUnexpectedEOF, true},
+		{"canceled", nil, &url.Error{Op: "Get", URL: "https://example.com", Err: context.Canceled}, false},
+		{"scheme", nil, &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New(`unsupported protocol scheme "ftp"`)}, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.res, tt.err); got != tt.want {
+			t.Errorf("%s: retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
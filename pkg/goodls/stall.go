@@ -0,0 +1,56 @@
+package goodls
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the timeouts.
+const (
+	defaultStallTimeout          = time.Minute
+	defaultConnectTimeout        = 30 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = time.Minute
+)
+
+// stallReader : Reader of a response body which is aborted when a read receives no bytes for timeout.
+// The time spent outside Read, e.g. waiting for the rate limiter, is not counted.
+type stallReader struct {
+	body    io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	stalled atomic.Bool
+}
+
+// watchStall : Abort body when it stalls for the stall timeout. body is returned as it is when the timeout is disabled.
+func (p *para) watchStall(body io.ReadCloser) io.ReadCloser {
+	if p.StallTimeout <= 0 {
+		return body
+	}
+	r := &stallReader{body: body, timeout: p.StallTimeout}
+	r.timer = time.AfterFunc(time.Hour, func() {
+		r.stalled.Store(true)
+		// Closing the body unblocks the pending Read.
+		r.body.Close()
+	})
+	r.timer.Stop()
+	return r
+}
+
+// Read : Implement io.Reader. ErrStalled is returned when the body has been aborted by the watchdog.
+func (r *stallReader) Read(b []byte) (int, error) {
+	r.timer.Reset(r.timeout)
+	n, err := r.body.Read(b)
+	r.timer.Stop()
+	if r.stalled.Load() {
+		return n, ErrStalled
+	}
+	return n, err
+}
+
+// Close : Implement io.Closer.
+func (r *stallReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
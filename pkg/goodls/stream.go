@@ -0,0 +1,105 @@
+package goodls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+)
+
+// StdoutPath : Path of Result for a file written to the writer of WithOutput.
+const StdoutPath = "-"
+
+// saveStream : Write the content of res to p.Output instead of a local file. Conflict resolution, the free space
+// check and the .part file are not used. The checksums are verified after the content has been written,
+// so a mismatch is reported by the error only.
+func (p *para) saveStream(ctx context.Context, res *http.Response) error {
+	defer res.Body.Close()
+	if p.Size <= 0 {
+		p.Size = res.ContentLength
+	}
+	bar := p.newBar()
+	if p.FileRateLimit > 0 {
+		p.fileLimiter = NewRateLimiter(p.FileRateLimit)
+	}
+
+	h := newHasher(p.Verify)
+	n, err := p.copyStream(ctx, res, io.MultiWriter(p.Output, h), bar)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if bar != nil {
+		if err != nil {
+			bar.Abort(false)
+		} else {
+			bar.SetTotal(-1, true)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	sums := h.sums()
+	if sums.Verification, err = p.verify(sums); err != nil {
+		return err
+	}
+	p.addResult(Result{
+		Path:         StdoutPath,
+		Filename:     p.Filename,
+		Type:         p.Kind,
+		MimeType:     p.ContentType,
+		FileSize:     n,
+		MD5:          sums.MD5,
+		SHA256:       sums.SHA256,
+		Verification: sums.Verification,
+	})
+	return nil
+}
+
+// copyStream : Copy the body of res to w. The written bytes cannot be taken back, so when the size is known and
+// the retries are enabled, a broken stream is continued with a Range request from the last written byte.
+func (p *para) copyStream(ctx context.Context, res *http.Response, w io.Writer, bar *mpb.Bar) (int64, error) {
+	url := res.Request.URL.String()
+	rp := p.retryPolicy()
+	start := time.Now()
+	body := res.Body
+	var written int64
+	for attempt := 0; ; {
+		n, err := io.Copy(w, p.bodyReader(ctx, &streamReader{r: p.watchStall(body)}, bar))
+		body.Close()
+		written += n
+		if err == nil && p.Size > 0 && written < p.Size {
+			err = &streamError{err: io.ErrUnexpectedEOF}
+		}
+		var streamErr *streamError
+		if err == nil || ctx.Err() != nil || !errors.As(err, &streamErr) || rp.Retries == 0 || p.Size <= 0 {
+			return written, err
+		}
+		if n > 0 {
+			attempt, start = 0, time.Now()
+		}
+		d, ok := rp.next(attempt, start, nil)
+		if !ok {
+			return written, err
+		}
+		attempt++
+		if p.Verbose {
+			p.mu.Lock()
+			fmt.Fprintf(os.Stderr, "[Verbose] Connection of '%s' broke at byte %d: %v. Reconnecting in %v\n", p.Filename, written, err, d)
+			p.mu.Unlock()
+		}
+		if err := sleepContext(ctx, d); err != nil {
+			return written, err
+		}
+		r, err := p.fetchRange(ctx, url, byteRange{Start: written, End: p.Size - 1})
+		if err != nil {
+			return written, err
+		}
+		body = r.Body
+	}
+}
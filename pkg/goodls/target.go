@@ -0,0 +1,168 @@
+package goodls
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TargetKind : Kind of the resource which a URL points to.
+type TargetKind string
+
+// Kinds of Target. The kinds of Google Docs files are the path segments of docs.google.com, so that other kinds
+// such as "forms" are exported in the same way.
+const (
+	TargetFile         TargetKind = "file"
+	TargetFolder       TargetKind = "folder"
+	TargetDocument     TargetKind = "document"
+	TargetSpreadsheet  TargetKind = "spreadsheets"
+	TargetPresentation TargetKind = "presentation"
+	TargetDrawing      TargetKind = "drawings"
+)
+
+// Target : Resource on Google Drive parsed from a URL by ParseTarget.
+type Target struct {
+	Kind        TargetKind
+	ID          string
+	ResourceKey string // "resourcekey" of a file shared by a link before the security update of 2021
+	GID         string // Sheet of a spreadsheet ("gid")
+	Format      string // Export format in the URL, e.g. "pdf" of ".../export?format=pdf"
+}
+
+// Hosts of the URLs accepted by ParseTarget.
+const (
+	driveHost = "drive.google.com"
+	docsHost  = "docs.google.com"
+	colabHost = "colab.research.google.com"
+)
+
+// Patterns of the parts of a URL. The IDs and the resource keys of Google Drive consist of these characters only.
+var (
+	idPattern       = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	bareIDPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]{25,}$`)
+	gidPattern      = regexp.MustCompile(`^[0-9]+$`)
+	formatPattern   = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	accountSegments = regexp.MustCompile(`/u/[0-9]+(/|$)`)
+)
+
+// targetRules : Table of the URLs of Google Drive. The path, without the account segment such as "/u/1", is
+// matched with path, whose named groups are the ID ("id"), the kind ("kind") and the rest of the path ("rest").
+// Without "id", the ID is the query parameter query. Without "kind", the kind is kind. The first matching rule wins.
+var targetRules = []struct {
+	hosts []string
+	path  *regexp.Regexp
+	query string
+	kind  TargetKind
+}{
+	{[]string{driveHost, docsHost}, regexp.MustCompile(`^/file/d/(?P<id>[^/]+)(?P<rest>/.*)?$`), "", TargetFile},
+	{[]string{docsHost, driveHost}, regexp.MustCompile(`^/(?P<kind>[a-z]+)/d/(?P<id>[^/]+)(?P<rest>/.*)?$`), "", ""},
+	{[]string{driveHost}, regexp.MustCompile(`^/drive/(mobile/)?folders/(?P<id>[^/]+)(?P<rest>/.*)?$`), "", TargetFolder},
+	{[]string{driveHost}, regexp.MustCompile(`^/(embedded)?folderview/?$`), "id", TargetFolder},
+	{[]string{driveHost, docsHost}, regexp.MustCompile(`^/(uc|open|download)/?$`), "id", TargetFile},
+	{[]string{userContentHost}, regexp.MustCompile(`^/(uc|download)?/?$`), "id", TargetFile},
+	{[]string{docsHost}, regexp.MustCompile(`^/spreadsheet/(ccc|pub|lv)/?$`), "key", TargetSpreadsheet},
+	{[]string{colabHost}, regexp.MustCompile(`^/drive/(?P<id>[^/]+)(?P<rest>/.*)?$`), "", TargetFile},
+}
+
+// ParseTarget : Parse a URL of Google Drive, Google Docs, Colaboratory or drive.usercontent.google.com, or a bare
+// file ID. The scheme may be omitted. "open?id=" is taken as a file, because the kind is not in the URL.
+// ErrInvalidURL is returned for anything else.
+func ParseTarget(s string) (Target, error) {
+	s = strings.TrimSpace(s)
+	if bareIDPattern.MatchString(s) {
+		return Target{Kind: TargetFile, ID: s}, nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return Target{}, ErrInvalidURL
+	}
+	host := strings.ToLower(u.Hostname())
+	path := accountSegments.ReplaceAllString(u.Path, "/")
+	q := u.Query()
+
+	for _, rule := range targetRules {
+		if !slices.Contains(rule.hosts, host) {
+			continue
+		}
+		m := rule.path.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		group := func(name string) string {
+			if i := rule.path.SubexpIndex(name); i > 0 {
+				return m[i]
+			}
+			return ""
+		}
+		t := Target{Kind: rule.kind, ID: group("id")}
+		if k := group("kind"); k != "" {
+			t.Kind = TargetKind(k)
+		}
+		if rule.query != "" {
+			t.ID = q.Get(rule.query)
+		}
+		if !idPattern.MatchString(t.ID) {
+			return Target{}, ErrInvalidURL
+		}
+		t.parseOptions(q, u.Fragment, group("rest"))
+		return t, nil
+	}
+	return Target{}, ErrInvalidURL
+}
+
+// parseOptions : Set the resource key, the gid and the export format from the query, the fragment and the rest of
+// the path. Values with unexpected characters are ignored.
+func (t *Target) parseOptions(q url.Values, fragment, rest string) {
+	if k := q.Get("resourcekey"); idPattern.MatchString(k) {
+		t.ResourceKey = k
+	}
+	gid := q.Get("gid")
+	if f, err := url.ParseQuery(fragment); gid == "" && err == nil {
+		gid = f.Get("gid")
+	}
+	if t.Kind == TargetSpreadsheet && gidPattern.MatchString(gid) {
+		t.GID = gid
+	}
+	if t.Kind == TargetFile || t.Kind == TargetFolder {
+		return
+	}
+	format := q.Get("format")
+	if f, ok := strings.CutPrefix(rest, "/export/"); ok && format == "" {
+		format = f
+	}
+	if formatPattern.MatchString(format) {
+		t.Format = strings.ToLower(format)
+	}
+}
+
+// URL : Canonical URL of t. ParseTarget returns t again from it.
+func (t Target) URL() string {
+	q := url.Values{}
+	if t.ResourceKey != "" {
+		q.Set("resourcekey", t.ResourceKey)
+	}
+	if t.GID != "" {
+		q.Set("gid", t.GID)
+	}
+	var u string
+	switch t.Kind {
+	case TargetFile:
+		u = "https://" + driveHost + "/file/d/" + t.ID + "/view"
+	case TargetFolder:
+		u = "https://" + driveHost + "/drive/folders/" + t.ID
+	default:
+		u = "https://" + docsHost + "/" + string(t.Kind) + "/d/" + t.ID + "/edit"
+		if t.Format != "" {
+			u = "https://" + docsHost + "/" + string(t.Kind) + "/d/" + t.ID + "/export"
+			q.Set("format", t.Format)
+		}
+	}
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
@@ -0,0 +1,144 @@
+package goodls
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+// targetTests : URLs copied from Google Drive and Google Docs, and the targets parsed from them.
+var targetTests = []struct {
+	url  string
+	want Target
+}{
+	// Files
+	{"https://drive.google.com/file/d/1AbC_dEf-123/view?usp=sharing", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/file/d/1AbC_dEf-123/view", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/file/d/1AbC_dEf-123/edit", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/file/d/1AbC_dEf-123/", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/file/d/1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/file/d/1AbC_dEf-123/preview", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/file/u/1/d/1AbC_dEf-123/view", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/u/0/file/d/1AbC_dEf-123/view", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/file/d/1AbC_dEf-123/view?resourcekey=0-XyZ_9", Target{Kind: TargetFile, ID: "1AbC_dEf-123", ResourceKey: "0-XyZ_9"}},
+	{"http://drive.google.com/file/d/1AbC_dEf-123/view", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"drive.google.com/file/d/1AbC_dEf-123/view", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"  https://drive.google.com/file/d/1AbC_dEf-123/view\n", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://DRIVE.GOOGLE.COM/file/d/1AbC_dEf-123/view", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://docs.google.com/file/d/1AbC_dEf-123/edit", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/open?id=1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/open?id=1AbC_dEf-123&resourcekey=0-k", Target{Kind: TargetFile, ID: "1AbC_dEf-123", ResourceKey: "0-k"}},
+	{"https://drive.google.com/uc?id=1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/uc?id=1AbC_dEf-123&export=download", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/uc?export=download&id=1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/uc?export=view&id=1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/u/1/uc?id=1AbC_dEf-123&export=download", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.google.com/download?id=1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://docs.google.com/uc?id=1AbC_dEf-123&export=download", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.usercontent.google.com/download?id=1AbC_dEf-123&export=download&confirm=t&uuid=u", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.usercontent.google.com/uc?id=1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.usercontent.google.com/u/0/uc?id=1AbC_dEf-123&export=download", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://drive.usercontent.google.com/?id=1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://colab.research.google.com/drive/1AbC_dEf-123", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"https://colab.research.google.com/drive/1AbC_dEf-123?usp=sharing#scrollTo=abc", Target{Kind: TargetFile, ID: "1AbC_dEf-123"}},
+	{"1AbCdEfGhIjKlMnOpQrStUvWxYz_-0123", Target{Kind: TargetFile, ID: "1AbCdEfGhIjKlMnOpQrStUvWxYz_-0123"}},
+
+	// Folders
+	{"https://drive.google.com/drive/folders/0Bx_fOlDeR?usp=sharing", Target{Kind: TargetFolder, ID: "0Bx_fOlDeR"}},
+	{"https://drive.google.com/drive/folders/0Bx_fOlDeR", Target{Kind: TargetFolder, ID: "0Bx_fOlDeR"}},
+	{"https://drive.google.com/drive/u/1/folders/0Bx_fOlDeR", Target{Kind: TargetFolder, ID: "0Bx_fOlDeR"}},
+	{"https://drive.google.com/drive/mobile/folders/0Bx_fOlDeR", Target{Kind: TargetFolder, ID: "0Bx_fOlDeR"}},
+	{"https://drive.google.com/drive/folders/0Bx_fOlDeR?resourcekey=0-k", Target{Kind: TargetFolder, ID: "0Bx_fOlDeR", ResourceKey: "0-k"}},
+	{"https://drive.google.com/folderview?id=0Bx_fOlDeR", Target{Kind: TargetFolder, ID: "0Bx_fOlDeR"}},
+	{"https://drive.google.com/embeddedfolderview?id=0Bx_fOlDeR#list", Target{Kind: TargetFolder, ID: "0Bx_fOlDeR"}},
+
+	// Google Docs files
+	{"https://docs.google.com/document/d/1DoC/edit?usp=sharing", Target{Kind: TargetDocument, ID: "1DoC"}},
+	{"https://docs.google.com/document/d/1DoC", Target{Kind: TargetDocument, ID: "1DoC"}},
+	{"https://docs.google.com/document/u/0/d/1DoC/edit", Target{Kind: TargetDocument, ID: "1DoC"}},
+	{"https://docs.google.com/document/d/1DoC/export?format=docx", Target{Kind: TargetDocument, ID: "1DoC", Format: "docx"}},
+	{"https://docs.google.com/document/d/1DoC/edit?resourcekey=0-k", Target{Kind: TargetDocument, ID: "1DoC", ResourceKey: "0-k"}},
+	{"https://drive.google.com/document/d/1DoC/edit", Target{Kind: TargetDocument, ID: "1DoC"}},
+	{"https://docs.google.com/spreadsheets/d/1ShEeT/edit#gid=123", Target{Kind: TargetSpreadsheet, ID: "1ShEeT", GID: "123"}},
+	{"https://docs.google.com/spreadsheets/d/1ShEeT/edit?gid=0#gid=0", Target{Kind: TargetSpreadsheet, ID: "1ShEeT", GID: "0"}},
+	{"https://docs.google.com/spreadsheets/d/1ShEeT/export?format=CSV&gid=7", Target{Kind: TargetSpreadsheet, ID: "1ShEeT", GID: "7", Format: "csv"}},
+	{"https://docs.google.com/spreadsheets/d/1ShEeT/edit#gid=abc", Target{Kind: TargetSpreadsheet, ID: "1ShEeT"}},
+	{"https://docs.google.com/spreadsheet/ccc?key=1ShEeT#gid=2", Target{Kind: TargetSpreadsheet, ID: "1ShEeT", GID: "2"}},
+	{"https://docs.google.com/presentation/d/1SlIdE/edit#slide=id.p", Target{Kind: TargetPresentation, ID: "1SlIdE"}},
+	{"https://docs.google.com/presentation/d/1SlIdE/export/pptx", Target{Kind: TargetPresentation, ID: "1SlIdE", Format: "pptx"}},
+	{"https://docs.google.com/presentation/u/2/d/1SlIdE/present", Target{Kind: TargetPresentation, ID: "1SlIdE"}},
+	{"https://docs.google.com/drawings/d/1DrAw/edit", Target{Kind: TargetDrawing, ID: "1DrAw"}},
+	{"https://docs.google.com/forms/d/1FoRm/viewform", Target{Kind: "forms", ID: "1FoRm"}},
+}
+
+// invalidTargets : URLs which are refused with ErrInvalidURL.
+var invalidTargets = []string{
+	"",
+	"https://example.com/file",
+	"https://example.com/file/d/1AbC/view",
+	"https://drive.google.com/",
+	"https://drive.google.com/drive/my-drive",
+	"https://drive.google.com/file/d//view",
+	"https://drive.google.com/file/d/1Ab%20C/view",
+	"https://drive.google.com/uc?export=download",
+	"https://drive.google.com/open?id=",
+	"https://drive.usercontent.google.com/download?export=download",
+	"https://docs.google.com/Forms/d/1FoRm/viewform",
+	"https://docs.google.com/drive/folders/0Bx_fOlDeR",
+	"ftp://drive.google.com/file/d/1AbC/view",
+	"drive.google.com.evil.com/file/d/1AbC/view",
+	"short_id",
+	"not an id with spaces and more than 25 chars",
+}
+
+func TestParseTarget(t *testing.T) {
+	for _, tt := range targetTests {
+		got, err := ParseTarget(tt.url)
+		if err != nil {
+			t.Errorf("%q: %v", tt.url, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.url, got, tt.want)
+		}
+		// The canonical URL is parsed to the same target.
+		if again, err := ParseTarget(got.URL()); err != nil || again != got {
+			t.Errorf("%q: %s is parsed to %+v, %v", tt.url, got.URL(), again, err)
+		}
+	}
+	for _, s := range invalidTargets {
+		if got, err := ParseTarget(s); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("%q: got %+v, %v, want ErrInvalidURL", s, got, err)
+		}
+	}
+}
+
+// kindPattern : Kinds are used as a path segment of the export URL.
+var kindPattern = regexp.MustCompile(`^[a-z]+$`)
+
+func FuzzParseTarget(f *testing.F) {
+	for _, tt := range targetTests {
+		f.Add(tt.url)
+	}
+	for _, s := range invalidTargets {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got, err := ParseTarget(s)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidURL) {
+				t.Fatalf("%q: unexpected error %v", s, err)
+			}
+			return
+		}
+		if !kindPattern.MatchString(string(got.Kind)) {
+			t.Fatalf("%q: unsafe kind %q", s, got.Kind)
+		}
+		if !idPattern.MatchString(got.ID) || (got.ResourceKey != "" && !idPattern.MatchString(got.ResourceKey)) {
+			t.Fatalf("%q: unsafe ID or resource key in %+v", s, got)
+		}
+		if again, err := ParseTarget(got.URL()); err != nil || again != got {
+			t.Fatalf("%q: %s is parsed to %+v, %v, want %+v", s, got.URL(), again, err, got)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package goodls
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// Verification : Result of the comparison of the checksums with those on Google Drive.
+type Verification string
+
+// Verification statuses recorded in Result.
+const (
+	VerificationPassed      Verification = "passed"      // The checksums match.
+	VerificationFailed      Verification = "failed"      // The checksums did not match even after the retries.
+	VerificationUnavailable Verification = "unavailable" // Google Drive reported no checksum, e.g. without an API key or for Google Docs.
+)
+
+// checksums : Checksums of a downloaded file.
+type checksums struct {
+	MD5          string
+	SHA256       string
+	Verification Verification
+}
+
+// hasher : Writer which computes the md5 and, when it is required, the sha256 of the written data.
+type hasher struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+}
+
+// newHasher : Create a hasher. sha256 is computed only when withSHA256 is true.
+func newHasher(withSHA256 bool) *hasher {
+	h := &hasher{md5: md5.New()}
+	if withSHA256 {
+		h.sha256 = sha256.New()
+	}
+	return h
+}
+
+// Write : Implement io.Writer.
+func (h *hasher) Write(b []byte) (int, error) {
+	h.md5.Write(b)
+	if h.sha256 != nil {
+		h.sha256.Write(b)
+	}
+	return len(b), nil
+}
+
+// sums : Checksums of the written data.
+func (h *hasher) sums() checksums {
+	c := checksums{MD5: hex.EncodeToString(h.md5.Sum(nil))}
+	if h.sha256 != nil {
+		c.SHA256 = hex.EncodeToString(h.sha256.Sum(nil))
+	}
+	return c
+}
+
+// fileChecksums : Checksums of a local file.
+func fileChecksums(name string, withSHA256 bool) (checksums, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer f.Close()
+	h := newHasher(withSHA256)
+	if _, err := io.Copy(h, f); err != nil {
+		return checksums{}, err
+	}
+	return h.sums(), nil
+}
+
+// verify : Compare the checksums with md5Checksum and sha256Checksum of Google Drive.
+// The md5 is always compared when it is known. "" is returned when nothing was compared without '--verify'.
+func (p *para) verify(sums checksums) (Verification, error) {
+	var mismatch []string
+	compared := false
+	if p.MD5Checksum != "" {
+		compared = true
+		if sums.MD5 != p.MD5Checksum {
+			mismatch = append(mismatch, fmt.Sprintf("md5 is %s, but %s is expected", sums.MD5, p.MD5Checksum))
+		}
+	}
+	if p.Verify && p.SHA256Checksum != "" {
+		compared = true
+		if sums.SHA256 != p.SHA256Checksum {
+			mismatch = append(mismatch, fmt.Sprintf("sha256 is %s, but %s is expected", sums.SHA256, p.SHA256Checksum))
+		}
+	}
+	switch {
+	case len(mismatch) > 0:
+		return VerificationFailed, &FileError{ID: p.ID, Err: fmt.Errorf("%w: %s", ErrChecksumMismatch, mismatch[0])}
+	case compared:
+		return VerificationPassed, nil
+	case p.Verify:
+		return VerificationUnavailable, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,100 @@
+package goodls
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Names of the extended attributes written with '--xattr'.
+const (
+	xattrID           = "user.goodls.id"
+	xattrMD5          = "user.goodls.md5"
+	xattrURL          = "user.goodls.url"
+	xattrModifiedTime = "user.goodls.modifiedTime"
+	xattrMimeType     = "user.goodls.mimeType"
+)
+
+// Provenance : Origin of a local file on Google Drive. It is recorded in the extended attributes of the file
+// with WithXattr, which are supported on Linux.
+type Provenance struct {
+	ID           string    // File ID on Google Drive
+	MD5          string    // md5 of the saved content
+	URL          string    // URL given to goodls
+	ModifiedTime time.Time // modifiedTime on Google Drive when the file was saved
+	MimeType     string
+}
+
+// ReadProvenance : Read the provenance recorded in the extended attributes of path. false is returned when
+// the file has no provenance or the platform does not support extended attributes.
+func ReadProvenance(path string) (Provenance, bool) {
+	id, err := getXattr(path, xattrID)
+	if err != nil || id == "" {
+		return Provenance{}, false
+	}
+	pr := Provenance{ID: id}
+	pr.MD5, _ = getXattr(path, xattrMD5)
+	pr.URL, _ = getXattr(path, xattrURL)
+	pr.MimeType, _ = getXattr(path, xattrMimeType)
+	if s, err := getXattr(path, xattrModifiedTime); err == nil {
+		pr.ModifiedTime = driveTime(s)
+	}
+	return pr, true
+}
+
+// writeProvenance : Record pr in the extended attributes of path. Empty values are not written.
+func writeProvenance(path string, pr Provenance) error {
+	attrs := [][2]string{
+		{xattrID, pr.ID},
+		{xattrMD5, pr.MD5},
+		{xattrURL, pr.URL},
+		{xattrMimeType, pr.MimeType},
+	}
+	if !pr.ModifiedTime.IsZero() {
+		attrs = append(attrs, [2]string{xattrModifiedTime, pr.ModifiedTime.UTC().Format(time.RFC3339Nano)})
+	}
+	for _, a := range attrs {
+		if a[1] == "" {
+			continue
+		}
+		if err := setXattr(path, a[0], a[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordProvenance : Record pr on the saved file with '--xattr'. A failure, e.g. on a filesystem without
+// extended attributes, is only a warning.
+func (p *para) recordProvenance(path string, pr Provenance) {
+	if !p.Xattr {
+		return
+	}
+	if err := writeProvenance(path, pr); err != nil && !p.Disp && !p.MCPMode {
+		p.mu.Lock()
+		fmt.Fprintf(os.Stderr, "[*] Warning: Cannot write the extended attributes of '%s': %v\n", path, err)
+		p.mu.Unlock()
+	}
+}
+
+// unchangedFile : Whether the local file at path is the current version of the file id on Google Drive according to
+// its provenance, so that it is identified without hashing it. The md5 on Google Drive is compared when it is known,
+// otherwise modifiedTime. The size is compared as well when it is known, which catches most local edits.
+func unchangedFile(path, id string, size int64, md5sum string, modified time.Time) bool {
+	pr, ok := ReadProvenance(path)
+	if !ok || pr.ID != id {
+		return false
+	}
+	if size > 0 {
+		if info, err := os.Stat(path); err != nil || info.Size() != size {
+			return false
+		}
+	}
+	switch {
+	case md5sum != "" && pr.MD5 != "":
+		return pr.MD5 == md5sum
+	case !modified.IsZero() && !pr.ModifiedTime.IsZero():
+		return pr.ModifiedTime.Equal(modified)
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package goodls
+
+import "golang.org/x/sys/unix"
+
+// setXattr : Set the extended attribute name of path.
+func setXattr(path, name, value string) error {
+	return unix.Setxattr(path, name, []byte(value), 0)
+}
+
+// getXattr : Value of the extended attribute name of path.
+func getXattr(path, name string) (string, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, size)
+	n, err := unix.Getxattr(path, name, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
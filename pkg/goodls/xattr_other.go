@@ -0,0 +1,15 @@
+//go:build !linux
+
+package goodls
+
+import "errors"
+
+// setXattr : Extended attributes are written only on Linux.
+func setXattr(path, name, value string) error {
+	return errors.ErrUnsupported
+}
+
+// getXattr : Extended attributes are read only on Linux.
+func getXattr(path, name string) (string, error) {
+	return "", errors.ErrUnsupported
+}
@@ -0,0 +1,68 @@
+package goodls
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// provenanceFile : Create a file with pr in a temporary directory. The test is skipped without extended attributes.
+func provenanceFile(t *testing.T, content string, pr Provenance) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeProvenance(path, pr); err != nil {
+		t.Skipf("extended attributes are not supported: %v", err)
+	}
+	return path
+}
+
+func TestProvenance(t *testing.T) {
+	want := Provenance{
+		ID:           "abc",
+		MD5:          "0123456789abcdef0123456789abcdef",
+		URL:          "https://drive.google.com/file/d/abc/view",
+		ModifiedTime: time.Date(2020, 1, 2, 3, 4, 5, 600000000, time.UTC),
+		MimeType:     "text/csv",
+	}
+	path := provenanceFile(t, "content", want)
+	got, ok := ReadProvenance(path)
+	if !ok || got != want {
+		t.Errorf("got %+v, %v, want %+v", got, ok, want)
+	}
+
+	plain := filepath.Join(t.TempDir(), "plain.bin")
+	os.WriteFile(plain, nil, 0666)
+	if _, ok := ReadProvenance(plain); ok {
+		t.Error("a file without the attributes has a provenance")
+	}
+}
+
+func TestUnchangedFile(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	path := provenanceFile(t, "content", Provenance{ID: "abc", MD5: "md5", ModifiedTime: modified})
+	tests := []struct {
+		name     string
+		id       string
+		size     int64
+		md5      string
+		modified time.Time
+		want     bool
+	}{
+		{"same md5", "abc", 7, "md5", time.Time{}, true},
+		{"other md5", "abc", 7, "other", modified, false},
+		{"same time", "abc", 0, "", modified, true},
+		{"newer time", "abc", 0, "", modified.Add(time.Second), false},
+		{"other size", "abc", 8, "md5", modified, false},
+		{"other id", "xyz", 7, "md5", modified, false},
+		{"nothing to compare", "abc", 7, "", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if got := unchangedFile(path, tt.id, tt.size, tt.md5, tt.modified); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}